@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/coverage"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/muskinfra/covdata"
+)
+
+// requestIDHeader marks a request whose coverage should be recorded. The
+// blocks it covered can then be fetched from /coverage/requests/{id}.
+const requestIDHeader = "X-Fuzz-Request-Id"
+
+// maxAttributedRequests bounds how many per-request deltas are kept; the
+// oldest are dropped first.
+const maxAttributedRequests = 1024
+
+// requestCoverage remembers the blocks covered by recent attributed
+// requests. They are kept with their functions, so that the filter of the
+// request that fetches them can be applied as /coverage applies it.
+type requestCoverage struct {
+	mu     sync.Mutex
+	blocks map[string][]covdata.Block
+	order  []string
+}
+
+var attributed = &requestCoverage{blocks: make(map[string][]covdata.Block)}
+
+// attributionMu serializes attributed requests, so that a delta holds only
+// the blocks of its own request. Requests without the header still run
+// concurrently and may leak into a delta.
+var attributionMu sync.Mutex
+
+func (c *requestCoverage) add(id string, blocks []covdata.Block) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.blocks[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.blocks[id] = blocks
+	if len(c.order) > maxAttributedRequests {
+		delete(c.blocks, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *requestCoverage) get(id string) ([]covdata.Block, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	blocks, ok := c.blocks[id]
+	return blocks, ok
+}
+
+// attributeCoverage snapshots the counters around every request that carries
+// a request ID and stores the blocks the request covered, with the number
+// of times it ran each.
+func attributeCoverage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		attributionMu.Lock()
+		defer attributionMu.Unlock()
+
+		// decode only after the second snapshot, so that the decoder's own
+		// blocks do not show up in the delta
+		var before, after bytes.Buffer
+		beforeErr := coverage.WriteCounters(&before)
+		next.ServeHTTP(w, r)
+		afterErr := coverage.WriteCounters(&after)
+		if beforeErr != nil || afterErr != nil {
+			fmt.Println("Error reading coverage around request:", beforeErr, afterErr)
+			return
+		}
+
+		blocks, err := requestBlocks(before.Bytes(), after.Bytes())
+		if err != nil {
+			fmt.Println("Error computing request coverage:", err)
+			return
+		}
+		attributed.add(id, blocks)
+	})
+}
+
+// requestBlocks decodes two counter snapshots and returns the blocks that
+// ran in between, with the number of times they ran.
+func requestBlocks(before, after []byte) ([]covdata.Block, error) {
+	meta, err := readMeta()
+	if err != nil {
+		return nil, err
+	}
+	beforeCounters, err := covdata.ReadCounters(before)
+	if err != nil {
+		return nil, err
+	}
+	afterCounters, err := covdata.ReadCounters(after)
+	if err != nil {
+		return nil, err
+	}
+	profile := covdata.NewProfile()
+	if err := profile.Add(meta, afterCounters.Delta(beforeCounters)); err != nil {
+		return nil, err
+	}
+	var blocks []covdata.Block
+	for _, block := range profile.Blocks() {
+		if block.Count > 0 {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+// requestCoverageSoFar returns the blocks covered by the request with the
+// given ID that the coverage filter keeps.
+func requestCoverageSoFar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := mux.Vars(r)["id"]
+	filter, err := coverageFilter(r)
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	covered, ok := attributed.get(id)
+	if !ok {
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode("No coverage recorded for request " + id)
+		return
+	}
+	blocks := []coverageBlock{}
+	for _, block := range covered {
+		if filter.Match(block) {
+			blocks = append(blocks, toCoverageBlock(block))
+		}
+	}
+	result := make(map[string]interface{})
+	result["id"] = id
+	result["blocks"] = blocks
+	json.NewEncoder(w).Encode(result)
+}
+
+// resetCoverage zeroes all counters, so that the next /coverage call only
+// reflects what happened since. It needs a binary built with
+// -covermode=atomic.
+func resetCoverage(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Called ResetCoverage")
+	attributionMu.Lock()
+	defer attributionMu.Unlock()
+	// keep what was counted so far in the checkpoint, the next one starts
+	// from zero
+	if checkpoints != nil {
+		if err := checkpoints.rotate(); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(err.Error())
+			return
+		}
+	}
+	if err := coverage.ClearCounters(); err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode("Coverage counters cleared")
+}
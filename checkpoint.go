@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/coverage"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/muskinfra/covdata"
+)
+
+// defaultCheckpointInterval is how often counters are written to GOCOVERDIR
+// unless COVERAGE_CHECKPOINT_INTERVAL says otherwise.
+const defaultCheckpointInterval = 30 * time.Second
+
+// checkpointer keeps a counter data file in GOCOVERDIR up to date while the
+// target runs, so that a crash or kill loses at most one interval of
+// coverage. Every write replaces the whole file with the process's current
+// counters, through a temporary file and a rename, so readers never see a
+// partial file.
+type checkpointer struct {
+	mu  sync.Mutex
+	dir string
+	// file is the name of the counter file of the current segment. It
+	// follows the runtime's covcounters.<hash>.<pid>.<nanotime> pattern, so
+	// go tool covdata and covreport pick it up.
+	file string
+}
+
+// checkpoints is nil unless checkpointing is enabled.
+var checkpoints *checkpointer
+
+func newCheckpointer(dir string) (*checkpointer, error) {
+	if err := coverage.WriteMetaDir(dir); err != nil {
+		return nil, err
+	}
+	c := &checkpointer{dir: dir}
+	return c, c.newSegment()
+}
+
+// newSegment starts a new counter file, leaving the previous one in place.
+func (c *checkpointer) newSegment() error {
+	meta, err := readMeta()
+	if err != nil {
+		return err
+	}
+	c.file = fmt.Sprintf("covcounters.%x.%d.%d", meta.Hash, os.Getpid(), time.Now().UnixNano())
+	return nil
+}
+
+// write replaces the counter file with the current counters.
+func (c *checkpointer) write() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeLocked()
+}
+
+func (c *checkpointer) writeLocked() error {
+	var buf bytes.Buffer
+	if err := coverage.WriteCounters(&buf); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, "tmp."+c.file+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(c.dir, c.file))
+}
+
+// rotate writes the counters and starts a new segment. It must be called
+// before the counters are cleared, since the next write would otherwise
+// replace what was counted so far.
+func (c *checkpointer) rotate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writeLocked(); err != nil {
+		return err
+	}
+	return c.newSegment()
+}
+
+// final writes the counters one last time before the process exits and
+// clears them, so that the file the runtime writes to GOCOVERDIR on exit
+// does not count them a second time.
+func (c *checkpointer) final() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writeLocked(); err != nil {
+		return err
+	}
+	return coverage.ClearCounters()
+}
+
+// run writes a checkpoint every interval, if interval is positive, and a
+// final one when the process is asked to stop with SIGINT or SIGTERM.
+func (c *checkpointer) run(interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			if err := c.write(); err != nil {
+				fmt.Println("Error checkpointing coverage:", err)
+			}
+		case sig := <-signals:
+			fmt.Println("Received", sig, "- checkpointing coverage")
+			if err := c.final(); err != nil {
+				fmt.Println("Error checkpointing coverage:", err)
+			}
+			os.Exit(1)
+		}
+	}
+}
+
+// checkpointInterval reads COVERAGE_CHECKPOINT_INTERVAL, a duration such as
+// "10s". Zero turns periodic checkpoints off; signals still trigger one.
+func checkpointInterval() time.Duration {
+	value := os.Getenv("COVERAGE_CHECKPOINT_INTERVAL")
+	if value == "" {
+		return defaultCheckpointInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Println("Invalid COVERAGE_CHECKPOINT_INTERVAL, using", defaultCheckpointInterval, ":", err)
+		return defaultCheckpointInterval
+	}
+	return interval
+}
+
+// startCheckpointing starts the background checkpointer when GOCOVERDIR is
+// set and the binary was built with -covermode=atomic, the only mode whose
+// counters can be written while it runs.
+func startCheckpointing() {
+	dir := os.Getenv("GOCOVERDIR")
+	if dir == "" {
+		return
+	}
+	meta, err := readMeta()
+	if err != nil {
+		return
+	}
+	if meta.Mode != covdata.ModeAtomic {
+		fmt.Printf("Coverage checkpoints need -covermode=atomic, target was built with -covermode=%s\n", meta.Mode)
+		return
+	}
+	c, err := newCheckpointer(dir)
+	if err != nil {
+		fmt.Println("Error starting coverage checkpoints:", err)
+		return
+	}
+	checkpoints = c
+	go c.run(checkpointInterval())
+}
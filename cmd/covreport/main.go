@@ -0,0 +1,215 @@
+// Command covreport reads raw coverage directories, as written to GOCOVERDIR
+// by binaries built with -cover, merges them and reports on the result
+// without needing the Go toolchain:
+//
+//	covreport summary -i cover,other-run -by func -exclude 'exitProgram,*_test.go'
+//	covreport textfmt -i cover,other-run -o profile.txt
+//	covreport diff -from coverage-snapshots/after-seed -to coverage-snapshots/after-1h
+//	covreport uncovered -i cover -src .
+//
+// Data written on any GOOS/GOARCH can be read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/muskinfra/covdata"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: covreport summary|textfmt|diff|uncovered [flags]")
+	fmt.Fprintln(os.Stderr, "run covreport <command> -h for the flags of a command")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "summary":
+		err = summary(os.Args[2:])
+	case "textfmt":
+		err = textfmt(os.Args[2:])
+	case "diff":
+		err = diff(os.Args[2:])
+	case "uncovered":
+		err = uncovered(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "covreport:", err)
+		os.Exit(1)
+	}
+}
+
+// readInputs merges the comma-separated directories of an -i flag.
+func readInputs(inputs string) (*covdata.Profile, error) {
+	if inputs == "" {
+		return nil, fmt.Errorf("no input directories, use -i")
+	}
+	return covdata.ReadDirs(strings.Split(inputs, ",")...)
+}
+
+// addFilterFlags registers -include and -exclude on fs. The returned
+// function keeps the functions of a profile that the flags select.
+func addFilterFlags(fs *flag.FlagSet) func(*covdata.Profile) (*covdata.Profile, error) {
+	include := fs.String("include", "", "comma-separated globs of packages, files or functions to count (default all)")
+	exclude := fs.String("exclude", "", "comma-separated globs of packages, files or functions to leave out")
+	return func(profile *covdata.Profile) (*covdata.Profile, error) {
+		filter, err := covdata.ParseFilter(*include, *exclude)
+		if err != nil {
+			return nil, err
+		}
+		return profile.Filter(filter), nil
+	}
+}
+
+func summary(args []string) error {
+	fs := flag.NewFlagSet("summary", flag.ExitOnError)
+	inputs := fs.String("i", "", "comma-separated coverage directories to merge")
+	by := fs.String("by", "pkg", "break coverage down by pkg, file or func")
+	filter := addFilterFlags(fs)
+	fs.Parse(args)
+
+	level, err := covdata.ParseLevel(*by)
+	if err != nil {
+		return err
+	}
+	profile, err := readInputs(*inputs)
+	if err != nil {
+		return err
+	}
+	if profile, err = filter(profile); err != nil {
+		return err
+	}
+	return writeSummary(os.Stdout, profile, level)
+}
+
+func writeSummary(w io.Writer, profile *covdata.Profile, level covdata.Level) error {
+	var platforms []string
+	for _, run := range profile.Runs {
+		if platform := run.GOOS + "/" + run.GOARCH; !containsString(platforms, platform) {
+			platforms = append(platforms, platform)
+		}
+	}
+	sort.Strings(platforms)
+	fmt.Fprintf(w, "mode: %s, counter files: %d, platforms: %s\n", profile.Mode, len(profile.Runs), strings.Join(platforms, " "))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, s := range profile.Summaries(level) {
+		fmt.Fprintf(tw, "%s\t%d/%d\t%.1f%%\n", s.Name, s.Covered, s.Total, s.Percent())
+	}
+	total := profile.Total()
+	fmt.Fprintf(tw, "%s\t%d/%d\t%.1f%%\n", total.Name, total.Covered, total.Total, total.Percent())
+	return tw.Flush()
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func textfmt(args []string) error {
+	fs := flag.NewFlagSet("textfmt", flag.ExitOnError)
+	inputs := fs.String("i", "", "comma-separated coverage directories to merge")
+	output := fs.String("o", "profile.txt", "text profile to write, - for standard output")
+	filter := addFilterFlags(fs)
+	fs.Parse(args)
+
+	profile, err := readInputs(*inputs)
+	if err != nil {
+		return err
+	}
+	if profile, err = filter(profile); err != nil {
+		return err
+	}
+	if *output == "-" {
+		return profile.WriteText(os.Stdout)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := profile.WriteText(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// diff lists the blocks covered in -to that were not covered in -from.
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	from := fs.String("from", "", "comma-separated coverage directories of the earlier run")
+	to := fs.String("to", "", "comma-separated coverage directories of the later run")
+	filter := addFilterFlags(fs)
+	fs.Parse(args)
+
+	fromProfile, err := readInputs(*from)
+	if err != nil {
+		return err
+	}
+	toProfile, err := readInputs(*to)
+	if err != nil {
+		return err
+	}
+	if fromProfile, err = filter(fromProfile); err != nil {
+		return err
+	}
+	if toProfile, err = filter(toProfile); err != nil {
+		return err
+	}
+	blocks := covdata.NewlyCovered(fromProfile, toProfile)
+	for _, block := range blocks {
+		fmt.Printf("%s\t%s\t%d\n", block.Position(), block.Func, block.Count)
+	}
+	fmt.Printf("%d newly covered blocks\n", len(blocks))
+	return nil
+}
+
+// uncovered lists the blocks no run reached, with their source lines when
+// the module is checked out at -src.
+func uncovered(args []string) error {
+	fs := flag.NewFlagSet("uncovered", flag.ExitOnError)
+	inputs := fs.String("i", "", "comma-separated coverage directories to merge")
+	src := fs.String("src", "", "module source directory to print lines from")
+	filter := addFilterFlags(fs)
+	fs.Parse(args)
+
+	profile, err := readInputs(*inputs)
+	if err != nil {
+		return err
+	}
+	if profile, err = filter(profile); err != nil {
+		return err
+	}
+	blocks := profile.Uncovered()
+	for _, block := range blocks {
+		fmt.Printf("%s\t%s\n", block.Position(), block.Func)
+		if *src == "" {
+			continue
+		}
+		lines, err := block.Lines(*src)
+		if err != nil {
+			return err
+		}
+		for i, line := range lines {
+			fmt.Printf("%6d  %s\n", int(block.StartLine)+i, line)
+		}
+	}
+	fmt.Printf("%d uncovered blocks\n", len(blocks))
+	return nil
+}
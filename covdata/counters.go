@@ -0,0 +1,183 @@
+package covdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+const (
+	counterFileHeaderSize = 32
+	counterFooterSize     = 16
+
+	flavorRaw     = 1
+	flavorULEB128 = 2
+)
+
+// FuncCounters holds the counters of one function, one per Unit of the
+// function's meta-data. Pkg and Func index Meta.Packages and Package.Funcs.
+type FuncCounters struct {
+	Pkg      uint32
+	Func     uint32
+	Counters []uint32
+}
+
+// Counters is a decoded counter data file. A file holds one segment per time
+// the process wrote counters; all segments are decoded into Funcs, in order.
+// Functions whose counters are all zero are usually left out by the writer.
+type Counters struct {
+	MetaHash [16]byte
+	GOOS     string
+	GOARCH   string
+	Args     []string
+	Funcs    []FuncCounters
+}
+
+// ReadCounters decodes a counter data file as written by
+// coverage.WriteCounters or to GOCOVERDIR.
+func ReadCounters(data []byte) (*Counters, error) {
+	r := &reader{data: data}
+	if !bytes.Equal(r.bytes(4), counterMagic) {
+		return nil, fmt.Errorf("not a coverage counter data file")
+	}
+	if version := r.uint32(binary.LittleEndian); version > counterFileVersion {
+		return nil, fmt.Errorf("counter data file version %d is not supported", version)
+	}
+	counters := &Counters{}
+	copy(counters.MetaHash[:], r.bytes(16))
+	flavor := r.uint8()
+	var order binary.ByteOrder = binary.LittleEndian
+	if r.uint8() != 0 {
+		order = binary.BigEndian
+	}
+	r.bytes(6)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var value func() uint32
+	switch flavor {
+	case flavorRaw:
+		value = func() uint32 { return r.uint32(order) }
+	case flavorULEB128:
+		value = func() uint32 { return uint32(r.uleb128()) }
+	default:
+		return nil, fmt.Errorf("unknown counter flavor %d", flavor)
+	}
+
+	if len(data) < counterFileHeaderSize+counterFooterSize {
+		return nil, errShortData
+	}
+	footer := &reader{data: data[len(data)-counterFooterSize:]}
+	if !bytes.Equal(footer.bytes(4), counterMagic) {
+		return nil, fmt.Errorf("counter data file has no footer")
+	}
+	footer.bytes(4)
+	segments := footer.uint32(binary.LittleEndian)
+	if segments == 0 {
+		return nil, fmt.Errorf("counter data file has no segments")
+	}
+
+	for seg := uint32(0); seg < segments; seg++ {
+		entries := r.uint64()
+		strTabLen := r.uint32(binary.LittleEndian)
+		argsLen := r.uint32(binary.LittleEndian)
+		if r.err != nil {
+			return nil, fmt.Errorf("error decoding segment %d: %w", seg, r.err)
+		}
+		if entries > uint64(len(data)) {
+			return nil, fmt.Errorf("segment %d claims %d functions", seg, entries)
+		}
+		strs := (&reader{data: r.bytes(int(strTabLen))}).stringTable()
+		args := r.bytes(int(argsLen))
+		if r.err != nil {
+			return nil, fmt.Errorf("error decoding segment %d: %w", seg, r.err)
+		}
+		if err := counters.readArgs(args, strs); err != nil {
+			return nil, fmt.Errorf("error decoding segment %d: %w", seg, err)
+		}
+		if rem := r.off % 4; rem != 0 {
+			r.bytes(4 - rem)
+		}
+
+		for i := uint64(0); i < entries; i++ {
+			n := value()
+			fc := FuncCounters{Pkg: value(), Func: value()}
+			if uint64(n) > uint64(len(data)) {
+				return nil, fmt.Errorf("function entry claims %d counters", n)
+			}
+			fc.Counters = make([]uint32, n)
+			for c := range fc.Counters {
+				fc.Counters[c] = value()
+			}
+			if r.err != nil {
+				return nil, fmt.Errorf("error decoding segment %d: %w", seg, r.err)
+			}
+			counters.Funcs = append(counters.Funcs, fc)
+		}
+		r.bytes(counterFooterSize)
+	}
+	return counters, r.err
+}
+
+// readArgs decodes the os.Args, GOOS and GOARCH recorded in a segment.
+func (c *Counters) readArgs(data []byte, strs []string) error {
+	r := &reader{data: data}
+	args := make(map[string]string)
+	for n := r.uleb128(); n > 0 && r.err == nil; n-- {
+		key, err := lookup(strs, r.uleb128())
+		if err != nil {
+			return err
+		}
+		value, err := lookup(strs, r.uleb128())
+		if err != nil {
+			return err
+		}
+		args[key] = value
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if goos, ok := args["GOOS"]; ok {
+		c.GOOS = goos
+	}
+	if goarch, ok := args["GOARCH"]; ok {
+		c.GOARCH = goarch
+	}
+	if argc, err := strconv.Atoi(args["argc"]); err == nil {
+		c.Args = c.Args[:0]
+		for i := 0; i < argc; i++ {
+			c.Args = append(c.Args, args[fmt.Sprintf("argv%d", i)])
+		}
+	}
+	return nil
+}
+
+// Delta returns the counts that were added between before and c, two
+// snapshots of the same process's counters. Functions whose counters did
+// not change are left out.
+func (c *Counters) Delta(before *Counters) *Counters {
+	type key struct{ pkg, fn uint32 }
+	previous := make(map[key][]uint32, len(before.Funcs))
+	for _, fc := range before.Funcs {
+		previous[key{fc.Pkg, fc.Func}] = fc.Counters
+	}
+	delta := &Counters{MetaHash: c.MetaHash, GOOS: c.GOOS, GOARCH: c.GOARCH, Args: c.Args}
+	for _, fc := range c.Funcs {
+		old := previous[key{fc.Pkg, fc.Func}]
+		diff := FuncCounters{Pkg: fc.Pkg, Func: fc.Func, Counters: make([]uint32, len(fc.Counters))}
+		changed := false
+		for i, v := range fc.Counters {
+			if i < len(old) && old[i] <= v {
+				v -= old[i]
+			}
+			diff.Counters[i] = v
+			changed = changed || v != 0
+		}
+		if changed {
+			delta.Funcs = append(delta.Funcs, diff)
+		}
+	}
+	return delta
+}
@@ -0,0 +1,259 @@
+package covdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+)
+
+func readSample(t *testing.T) (*Meta, *Counters) {
+	metaFiles, _ := filepath.Glob("../somedata/covmeta.*")
+	counterFiles, _ := filepath.Glob("../somedata/covcounters.*")
+	if len(metaFiles) != 1 || len(counterFiles) != 1 {
+		t.Fatalf("sample data missing: %v %v", metaFiles, counterFiles)
+	}
+	data, err := os.ReadFile(metaFiles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := ReadMeta(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = os.ReadFile(counterFiles[0]); err != nil {
+		t.Fatal(err)
+	}
+	counters, err := ReadCounters(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta, counters
+}
+
+func TestReadSample(t *testing.T) {
+	meta, counters := readSample(t)
+	if meta.Mode != ModeSet || len(meta.Packages) != 1 || meta.Packages[0].Path != "github.com/muskinfra" {
+		t.Errorf("unexpected meta-data: mode %s, packages %d", meta.Mode, len(meta.Packages))
+	}
+	if counters.GOOS != "darwin" || counters.GOARCH != "arm64" {
+		t.Errorf("wrong platform: got %s/%s", counters.GOOS, counters.GOARCH)
+	}
+	if counters.MetaHash != meta.Hash {
+		t.Errorf("counter data does not refer to the meta-data")
+	}
+}
+
+// testdata/somedata.txt is the output of go tool covdata textfmt -i somedata.
+func TestProfilesMatchCovdata(t *testing.T) {
+	meta, counters := readSample(t)
+	got, err := meta.Profiles(counters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := cover.ParseProfiles("testdata/somedata.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("wrong number of files: got %d want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].FileName != want[i].FileName || got[i].Mode != want[i].Mode {
+			t.Errorf("file %d: got %s (%s) want %s (%s)", i, got[i].FileName, got[i].Mode, want[i].FileName, want[i].Mode)
+		}
+		if len(got[i].Blocks) != len(want[i].Blocks) {
+			t.Fatalf("%s: got %d blocks want %d", want[i].FileName, len(got[i].Blocks), len(want[i].Blocks))
+		}
+		for j := range want[i].Blocks {
+			if got[i].Blocks[j] != want[i].Blocks[j] {
+				t.Errorf("%s block %d: got %+v want %+v", want[i].FileName, j, got[i].Blocks[j], want[i].Blocks[j])
+			}
+		}
+	}
+}
+
+func TestReadRejectsGarbage(t *testing.T) {
+	meta, err := os.ReadFile("testdata/somedata.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMeta(meta); err == nil {
+		t.Error("text profile accepted as meta-data")
+	}
+	if _, err := ReadCounters(meta); err == nil {
+		t.Error("text profile accepted as counter data")
+	}
+	sample, _ := filepath.Glob("../somedata/covmeta.*")
+	data, err := os.ReadFile(sample[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{3, 60, len(data) / 2, len(data) - 1} {
+		if _, err := ReadMeta(data[:n]); err == nil {
+			t.Errorf("meta-data truncated to %d bytes accepted", n)
+		}
+	}
+}
+
+func TestReadDirsMergesRuns(t *testing.T) {
+	profile, err := ReadDirs("../somedata", "../somedata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Runs) != 2 || profile.Runs[0].GOOS != "darwin" {
+		t.Errorf("runs not recorded: %+v", profile.Runs)
+	}
+	var text strings.Builder
+	if err := profile.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("testdata/somedata.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// set mode: covering a block twice is still covering it once
+	if text.String() != string(want) {
+		t.Errorf("merged text profile differs from go tool covdata textfmt:\n%s", text.String())
+	}
+
+	total := profile.Total()
+	if total.Covered != 48 || total.Total != 75 {
+		t.Errorf("wrong total: got %d/%d want 48/75", total.Covered, total.Total)
+	}
+	for _, s := range profile.Summaries(ByFunc) {
+		if s.Name == "github.com/muskinfra/main.go:getAllUsers" && s.Covered != 3 {
+			t.Errorf("wrong getAllUsers coverage: %+v", s)
+		}
+	}
+}
+
+func TestAddSumsCounts(t *testing.T) {
+	meta := &Meta{Mode: ModeCount, Packages: []*Package{{
+		Path:  "example.com/p",
+		Funcs: []Func{{Name: "f", File: "example.com/p/p.go", Units: []Unit{{1, 1, 2, 2, 1}, {3, 1, 4, 2, 2}}}},
+	}}}
+	run := &Counters{Funcs: []FuncCounters{{Pkg: 0, Func: 0, Counters: []uint32{2, 0}}}}
+	profile := NewProfile()
+	if err := profile.Add(meta, run, run); err != nil {
+		t.Fatal(err)
+	}
+	blocks := profile.Blocks()
+	if len(blocks) != 2 || blocks[0].Count != 4 || blocks[1].Count != 0 {
+		t.Errorf("counts not summed: %+v", blocks)
+	}
+
+	other := &Meta{Mode: ModeCount, Hash: [16]byte{1}, Packages: []*Package{{Path: "example.com/p", Hash: [16]byte{1}}}}
+	if err := profile.Add(other); err == nil {
+		t.Error("merged a package built from different sources")
+	}
+}
+
+func TestCountersDelta(t *testing.T) {
+	before := &Counters{Funcs: []FuncCounters{{Pkg: 0, Func: 0, Counters: []uint32{3, 1}}}}
+	after := &Counters{Funcs: []FuncCounters{
+		{Pkg: 0, Func: 0, Counters: []uint32{5, 1}},
+		{Pkg: 0, Func: 1, Counters: []uint32{1}},
+	}}
+	delta := after.Delta(before)
+	if len(delta.Funcs) != 2 {
+		t.Fatalf("wrong number of changed functions: got %d want %d", len(delta.Funcs), 2)
+	}
+	if got := delta.Funcs[0].Counters; got[0] != 2 || got[1] != 0 {
+		t.Errorf("wrong delta for a function seen before: %v", got)
+	}
+	if got := delta.Funcs[1].Counters; got[0] != 1 {
+		t.Errorf("wrong delta for a newly covered function: %v", got)
+	}
+	if unchanged := after.Delta(after); len(unchanged.Funcs) != 0 {
+		t.Errorf("delta of identical snapshots is not empty: %+v", unchanged.Funcs)
+	}
+}
+
+func TestNewlyCoveredAndUncovered(t *testing.T) {
+	meta := &Meta{Mode: ModeCount, Packages: []*Package{{
+		Path:       "example.com/p",
+		ModulePath: "example.com",
+		Funcs:      []Func{{Name: "f", File: "example.com/p/p.go", Units: []Unit{{1, 1, 2, 2, 1}, {3, 1, 4, 2, 2}, {5, 1, 5, 9, 1}}}},
+	}}}
+	before := NewProfile()
+	if err := before.Add(meta, &Counters{Funcs: []FuncCounters{{Counters: []uint32{1, 0, 0}}}}); err != nil {
+		t.Fatal(err)
+	}
+	after := NewProfile()
+	if err := after.Add(meta, &Counters{Funcs: []FuncCounters{{Counters: []uint32{3, 1, 0}}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	newly := NewlyCovered(before, after)
+	if len(newly) != 1 || newly[0].Position() != "example.com/p/p.go:3.1,4.2" {
+		t.Errorf("wrong newly covered blocks: %+v", newly)
+	}
+	uncovered := after.Uncovered()
+	if len(uncovered) != 1 || uncovered[0].StartLine != 5 {
+		t.Errorf("wrong uncovered blocks: %+v", uncovered)
+	}
+	if got := uncovered[0].SourceFile("src"); got != filepath.Join("src", "p", "p.go") {
+		t.Errorf("wrong source file: %s", got)
+	}
+}
+
+func TestBlockLines(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln()\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	block := Block{ModulePath: "example.com/m", File: "example.com/m/main.go", Unit: Unit{StartLine: 3, StartCol: 13, EndLine: 5, EndCol: 2, Stmts: 1}}
+	lines, err := block.Lines(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[1] != "\tprintln()" {
+		t.Errorf("wrong lines: %q", lines)
+	}
+
+	block.StartLine, block.EndLine = 10, 12
+	if _, err := block.Lines(dir); err == nil {
+		t.Error("read lines past the end of the file")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	meta, counters := readSample(t)
+	profile := NewProfile()
+	if err := profile.Add(meta, counters); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := ParseFilter("", "exitProgram, generateUser,SetupSwagger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range profile.Filter(filter).Summaries(ByFunc) {
+		for _, fn := range []string{"exitProgram", "generateUser", "SetupSwagger"} {
+			if strings.HasSuffix(s.Name, ":"+fn) || strings.Contains(s.Name, ":"+fn+".func") {
+				t.Errorf("excluded function %s still counted", s.Name)
+			}
+		}
+	}
+	if got, want := profile.Filter(filter).Total().Total, profile.Total().Total; got >= want {
+		t.Errorf("exclusion did not shrink the denominator: %d of %d", got, want)
+	}
+
+	only, err := ParseFilter("github.com/muskinfra/main.go", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summaries := profile.Filter(only).Summaries(ByFile); len(summaries) != 1 || summaries[0].Name != "github.com/muskinfra/main.go" {
+		t.Errorf("include kept other files: %+v", summaries)
+	}
+	if profile.Filter(Filter{}).Total() != profile.Total() {
+		t.Error("empty filter changed the profile")
+	}
+
+	if _, err := ParseFilter("[", ""); err == nil {
+		t.Error("accepted a malformed pattern")
+	}
+}
@@ -0,0 +1,79 @@
+package covdata
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Position renders the block's source range as "file:line.col,line.col".
+func (b Block) Position() string {
+	return fmt.Sprintf("%s:%d.%d,%d.%d", b.File, b.StartLine, b.StartCol, b.EndLine, b.EndCol)
+}
+
+// NewlyCovered returns the blocks that are covered in to but were not
+// covered in from, e.g. what a fuzzing campaign reached between two
+// snapshots. Blocks that from does not know about count as uncovered there.
+func NewlyCovered(from, to *Profile) []Block {
+	before := make(map[string]bool)
+	for _, block := range from.Blocks() {
+		if block.Count > 0 {
+			before[block.Package+" "+block.Position()] = true
+		}
+	}
+	var blocks []Block
+	for _, block := range to.Blocks() {
+		if block.Count > 0 && !before[block.Package+" "+block.Position()] {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// Uncovered returns the blocks that no run has reached.
+func (p *Profile) Uncovered() []Block {
+	var blocks []Block
+	for _, block := range p.Blocks() {
+		if block.Count == 0 {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// SourceFile maps the file name recorded for a block, which starts with
+// the module path, to a path below the module's source directory root.
+func (b Block) SourceFile(root string) string {
+	name := b.File
+	if b.ModulePath != "" && strings.HasPrefix(name, b.ModulePath+"/") {
+		name = strings.TrimPrefix(name, b.ModulePath+"/")
+	}
+	return filepath.Join(root, filepath.FromSlash(name))
+}
+
+// Lines reads the source lines the block spans from the module checked out
+// at root.
+func (b Block) Lines(root string) ([]string, error) {
+	f, err := os.Open(b.SourceFile(root))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for n := uint32(1); scanner.Scan() && n <= b.EndLine; n++ {
+		if n >= b.StartLine {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s has no line %d", b.SourceFile(root), b.StartLine)
+	}
+	return lines, nil
+}
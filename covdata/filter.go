@@ -0,0 +1,97 @@
+package covdata
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter decides which functions count toward coverage. A function is kept
+// if it matches one of the Include patterns, or Include is empty, and
+// matches none of the Exclude patterns.
+//
+// Patterns use path.Match syntax. A pattern containing a slash is matched
+// against the package path, the file name and the file name relative to
+// the module; one without a slash against the base name of the file and the
+// function name. Function literals match the name of the function they are
+// declared in, e.g. "SetupSwagger" also covers "SetupSwagger.func1".
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// ParseFilter builds a filter from comma-separated include and exclude
+// pattern lists, as given on a command line or in a query string.
+func ParseFilter(include, exclude string) (Filter, error) {
+	var f Filter
+	var err error
+	if f.Include, err = splitPatterns(include); err != nil {
+		return f, err
+	}
+	f.Exclude, err = splitPatterns(exclude)
+	return f, err
+}
+
+func splitPatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Match reports whether the filter keeps block.
+func (f Filter) Match(block Block) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, block) {
+		return false
+	}
+	return !matchAny(f.Exclude, block)
+}
+
+func matchAny(patterns []string, block Block) bool {
+	for _, pattern := range patterns {
+		var names []string
+		if strings.Contains(pattern, "/") {
+			names = []string{block.Package, block.File, strings.TrimPrefix(block.File, block.ModulePath+"/")}
+		} else {
+			fn, _, _ := strings.Cut(block.Func, ".func")
+			names = []string{path.Base(block.File), block.Func, fn}
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Filter returns a profile holding only the functions f keeps. Packages left
+// without functions are dropped. The result shares meta-data with p.
+func (p *Profile) Filter(f Filter) *Profile {
+	filtered := &Profile{Mode: p.Mode, Runs: p.Runs, packages: make(map[string]*mergedPackage)}
+	for path, pkg := range p.packages {
+		kept := &mergedPackage{Package: &Package{}}
+		*kept.Package = *pkg.Package
+		kept.Funcs = nil
+		for i, fn := range pkg.Funcs {
+			block := Block{Package: pkg.Path, ModulePath: pkg.ModulePath, Func: fn.Name, File: fn.File, Literal: fn.Literal}
+			if !f.Match(block) {
+				continue
+			}
+			kept.Funcs = append(kept.Funcs, fn)
+			kept.counts = append(kept.counts, pkg.counts[i])
+		}
+		if len(kept.Funcs) > 0 {
+			filtered.packages[path] = kept
+		}
+	}
+	return filtered
+}
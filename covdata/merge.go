@@ -0,0 +1,256 @@
+package covdata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// Profile is coverage data merged across processes and runs: the
+// instrumented packages with the summed counters of every counter file that
+// belongs to them. Packages are identified by import path; the same package
+// from two runs is only merged if it was built from the same source.
+type Profile struct {
+	Mode CounterMode
+	// Runs describes the processes the counters came from.
+	Runs     []Run
+	packages map[string]*mergedPackage
+}
+
+// Run is one counter data file, i.e. one process or one WriteCounters call.
+type Run struct {
+	File   string
+	GOOS   string
+	GOARCH string
+	Args   []string
+}
+
+type mergedPackage struct {
+	*Package
+	counts [][]uint32
+}
+
+// NewProfile returns an empty profile to add meta-data and counters to.
+func NewProfile() *Profile {
+	return &Profile{packages: make(map[string]*mergedPackage)}
+}
+
+// ReadDirs reads every covmeta.* and covcounters.* file in dirs, as written
+// to GOCOVERDIR, and merges them into one profile.
+func ReadDirs(dirs ...string) (*Profile, error) {
+	profile := NewProfile()
+	for _, dir := range dirs {
+		if err := profile.AddDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+// AddDir merges the coverage files of dir into the profile. Counter files
+// whose meta-data file is missing are an error.
+func (p *Profile) AddDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	metas := make(map[[16]byte]*Meta)
+	var counterFiles []string
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		switch {
+		case strings.HasPrefix(name, "covmeta."):
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			meta, err := ReadMeta(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			metas[meta.Hash] = meta
+		case strings.HasPrefix(name, "covcounters."):
+			counterFiles = append(counterFiles, path)
+		}
+	}
+	if len(metas) == 0 {
+		return fmt.Errorf("%s: no coverage meta-data files", dir)
+	}
+
+	added := make(map[[16]byte]bool)
+	for _, path := range counterFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		counters, err := ReadCounters(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		meta, ok := metas[counters.MetaHash]
+		if !ok {
+			return fmt.Errorf("%s: no meta-data file for hash %x", path, counters.MetaHash)
+		}
+		if err := p.Add(meta, counters); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		p.Runs[len(p.Runs)-1].File = path
+		added[meta.Hash] = true
+	}
+	// binaries that never wrote counters still contribute their statements
+	for hash, meta := range metas {
+		if !added[hash] {
+			if err := p.Add(meta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Add merges meta-data and any number of counter files written by the
+// binary it describes.
+func (p *Profile) Add(meta *Meta, counters ...*Counters) error {
+	if p.Mode == ModeInvalid {
+		p.Mode = meta.Mode
+	} else if meta.Mode != p.Mode {
+		return fmt.Errorf("cannot merge -covermode=%s data into -covermode=%s data", meta.Mode, p.Mode)
+	}
+
+	pkgs := make([]*mergedPackage, len(meta.Packages))
+	for i, pkg := range meta.Packages {
+		merged, ok := p.packages[pkg.Path]
+		if !ok {
+			merged = &mergedPackage{Package: pkg, counts: make([][]uint32, len(pkg.Funcs))}
+			p.packages[pkg.Path] = merged
+		} else if merged.Hash != pkg.Hash {
+			return fmt.Errorf("package %s was built from different sources in different runs", pkg.Path)
+		}
+		pkgs[i] = merged
+	}
+
+	for _, c := range counters {
+		if c.MetaHash != meta.Hash {
+			return fmt.Errorf("counter data for meta-data %x does not belong to meta-data %x", c.MetaHash, meta.Hash)
+		}
+		for _, fc := range c.Funcs {
+			if int(fc.Pkg) >= len(pkgs) || int(fc.Func) >= len(pkgs[fc.Pkg].Funcs) {
+				return fmt.Errorf("counters for unknown function %d of package %d", fc.Func, fc.Pkg)
+			}
+			pkg := pkgs[fc.Pkg]
+			merged := pkg.counts[fc.Func]
+			if len(merged) < len(fc.Counters) {
+				merged = append(merged, make([]uint32, len(fc.Counters)-len(merged))...)
+			}
+			for i, v := range fc.Counters {
+				merged[i] = mergeCount(p.Mode, merged[i], v)
+			}
+			pkg.counts[fc.Func] = merged
+		}
+		p.Runs = append(p.Runs, Run{GOOS: c.GOOS, GOARCH: c.GOARCH, Args: c.Args})
+	}
+	return nil
+}
+
+// Block is a unit together with the function and package it belongs to and
+// its merged count.
+type Block struct {
+	Package    string
+	ModulePath string
+	Func       string
+	File       string
+	Literal    bool
+	Unit
+	Count uint32
+}
+
+// Blocks lists every unit of the profile, ordered by package, file and
+// position as in a text profile.
+func (p *Profile) Blocks() []Block {
+	var blocks []Block
+	for _, path := range p.PackagePaths() {
+		pkg := p.packages[path]
+		start := len(blocks)
+		for f, fn := range pkg.Funcs {
+			counts := pkg.counts[f]
+			for u, unit := range fn.Units {
+				block := Block{Package: pkg.Path, ModulePath: pkg.ModulePath, Func: fn.Name, File: fn.File, Literal: fn.Literal, Unit: unit}
+				if u < len(counts) {
+					block.Count = counts[u]
+				}
+				blocks = append(blocks, block)
+			}
+		}
+		sortBlocks(blocks[start:])
+	}
+	return blocks
+}
+
+func sortBlocks(blocks []Block) {
+	sort.SliceStable(blocks, func(i, j int) bool {
+		bi, bj := blocks[i], blocks[j]
+		if bi.File != bj.File {
+			return bi.File < bj.File
+		}
+		if bi.StartLine != bj.StartLine {
+			return bi.StartLine < bj.StartLine
+		}
+		if bi.EndLine != bj.EndLine {
+			return bi.EndLine < bj.EndLine
+		}
+		if bi.StartCol != bj.StartCol {
+			return bi.StartCol < bj.StartCol
+		}
+		if bi.EndCol != bj.EndCol {
+			return bi.EndCol < bj.EndCol
+		}
+		return bi.Stmts < bj.Stmts
+	})
+}
+
+// PackagePaths returns the import paths of the profile's packages, sorted.
+func (p *Profile) PackagePaths() []string {
+	paths := make([]string, 0, len(p.packages))
+	for path := range p.packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// CoverProfiles converts the profile into the per-file form that
+// cover.ParseProfiles returns for a text profile.
+func (p *Profile) CoverProfiles() []*cover.Profile {
+	byFile := make(map[string]*cover.Profile)
+	for _, block := range p.Blocks() {
+		profile, ok := byFile[block.File]
+		if !ok {
+			profile = &cover.Profile{FileName: block.File, Mode: p.Mode.String()}
+			byFile[block.File] = profile
+		}
+		profile.Blocks = append(profile.Blocks, cover.ProfileBlock{
+			StartLine: int(block.StartLine),
+			StartCol:  int(block.StartCol),
+			EndLine:   int(block.EndLine),
+			EndCol:    int(block.EndCol),
+			NumStmt:   int(block.Stmts),
+			Count:     int(block.Count),
+		})
+	}
+
+	profiles := make([]*cover.Profile, 0, len(byFile))
+	for _, profile := range byFile {
+		sort.SliceStable(profile.Blocks, func(i, j int) bool {
+			bi, bj := profile.Blocks[i], profile.Blocks[j]
+			return bi.StartLine < bj.StartLine || bi.StartLine == bj.StartLine && bi.StartCol < bj.StartCol
+		})
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].FileName < profiles[j].FileName })
+	return profiles
+}
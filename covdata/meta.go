@@ -0,0 +1,213 @@
+// Package covdata decodes the coverage files written by binaries built with
+// -cover: the covmeta.* meta-data files and covcounters.* counter files that
+// runtime/coverage and GOCOVERDIR produce. It reads the binary format
+// directly, so neither the Go toolchain nor go tool covdata is needed, and
+// data written on any GOOS/GOARCH can be read anywhere.
+//
+// The format is defined by the internal/coverage packages of the Go
+// distribution; only version 1 of both files exists so far.
+package covdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+var (
+	metaMagic    = []byte{0x00, 'c', 'v', 'm'}
+	counterMagic = []byte{0x00, 'c', 'w', 'm'}
+)
+
+const (
+	metaFileVersion    = 1
+	counterFileVersion = 1
+
+	// metaFileHeaderSize and packageHeaderSize are the encoded sizes of
+	// coverage.MetaFileHeader and coverage.MetaSymbolHeader.
+	metaFileHeaderSize = 56
+	packageHeaderSize  = 44
+)
+
+// CounterMode is the -covermode a binary was built with.
+type CounterMode uint8
+
+const (
+	ModeInvalid CounterMode = iota
+	ModeSet
+	ModeCount
+	ModeAtomic
+)
+
+func (m CounterMode) String() string {
+	switch m {
+	case ModeSet:
+		return "set"
+	case ModeCount:
+		return "count"
+	case ModeAtomic:
+		return "atomic"
+	}
+	return "invalid"
+}
+
+// Unit is one coverable block of a function.
+type Unit struct {
+	StartLine, StartCol uint32
+	EndLine, EndCol     uint32
+	Stmts               uint32
+}
+
+// Func describes an instrumented function. Literal is set for function
+// literals, whose Name is that of the enclosing function.
+type Func struct {
+	Name    string
+	File    string
+	Literal bool
+	Units   []Unit
+}
+
+// Package is the meta-data of one instrumented package.
+type Package struct {
+	Name       string
+	Path       string
+	ModulePath string
+	Hash       [16]byte
+	Funcs      []Func
+}
+
+// Meta is a decoded meta-data file: every instrumented package of a binary.
+// Counter data refers to packages and functions by their index in Packages
+// and Funcs.
+type Meta struct {
+	Hash     [16]byte
+	Mode     CounterMode
+	PerFunc  bool
+	Packages []*Package
+}
+
+// ReadMeta decodes a meta-data file as written by coverage.WriteMeta or to
+// GOCOVERDIR.
+func ReadMeta(data []byte) (*Meta, error) {
+	r := &reader{data: data}
+	if !bytes.Equal(r.bytes(4), metaMagic) {
+		return nil, fmt.Errorf("not a coverage meta-data file")
+	}
+	if version := r.uint32(binary.LittleEndian); version > metaFileVersion {
+		return nil, fmt.Errorf("meta-data file version %d is not supported", version)
+	}
+	totalLength := r.uint64()
+	entries := r.uint64()
+	meta := &Meta{}
+	copy(meta.Hash[:], r.bytes(16))
+	r.uint32(binary.LittleEndian) // string table offset
+	r.uint32(binary.LittleEndian) // string table length
+	meta.Mode = CounterMode(r.uint8())
+	meta.PerFunc = r.uint8() == 2
+	r.bytes(6)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if totalLength > uint64(len(data)) || entries > totalLength {
+		return nil, fmt.Errorf("meta-data file is truncated: header claims %d bytes, have %d", totalLength, len(data))
+	}
+
+	offsets := make([]uint64, entries)
+	lengths := make([]uint64, entries)
+	for i := range offsets {
+		offsets[i] = r.uint64()
+	}
+	for i := range lengths {
+		lengths[i] = r.uint64()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	for i := range offsets {
+		if offsets[i]+lengths[i] > totalLength {
+			return nil, fmt.Errorf("package %d lies outside of the meta-data file", i)
+		}
+		pkg, err := readPackage(data[offsets[i] : offsets[i]+lengths[i]])
+		if err != nil {
+			return nil, fmt.Errorf("error decoding package %d: %w", i, err)
+		}
+		meta.Packages = append(meta.Packages, pkg)
+	}
+	return meta, nil
+}
+
+// readPackage decodes the meta-data blob of one package.
+func readPackage(data []byte) (*Package, error) {
+	r := &reader{data: data}
+	length := r.uint32(binary.LittleEndian)
+	pkgName := r.uint32(binary.LittleEndian)
+	pkgPath := r.uint32(binary.LittleEndian)
+	modulePath := r.uint32(binary.LittleEndian)
+	pkg := &Package{}
+	copy(pkg.Hash[:], r.bytes(16))
+	r.bytes(4)
+	r.uint32(binary.LittleEndian) // number of files
+	numFuncs := r.uint32(binary.LittleEndian)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if uint64(length) > uint64(len(data)) || uint64(numFuncs)*4 > uint64(len(data)) {
+		return nil, fmt.Errorf("package header claims %d bytes and %d functions in %d bytes", length, numFuncs, len(data))
+	}
+
+	funcOffsets := make([]uint32, numFuncs)
+	for i := range funcOffsets {
+		funcOffsets[i] = r.uint32(binary.LittleEndian)
+	}
+	strs := r.stringTable()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var err error
+	if pkg.Name, err = lookup(strs, uint64(pkgName)); err != nil {
+		return nil, err
+	}
+	if pkg.Path, err = lookup(strs, uint64(pkgPath)); err != nil {
+		return nil, err
+	}
+	if pkg.ModulePath, err = lookup(strs, uint64(modulePath)); err != nil {
+		return nil, err
+	}
+
+	pkg.Funcs = make([]Func, numFuncs)
+	for i, off := range funcOffsets {
+		if off > length {
+			return nil, fmt.Errorf("function %d at offset %d outside of package", i, off)
+		}
+		r.seek(int(off))
+		numUnits := r.uleb128()
+		name := r.uleb128()
+		file := r.uleb128()
+		if numUnits > uint64(len(data)) {
+			return nil, fmt.Errorf("function %d claims %d units", i, numUnits)
+		}
+		fn := &pkg.Funcs[i]
+		fn.Units = make([]Unit, numUnits)
+		for u := range fn.Units {
+			fn.Units[u] = Unit{
+				StartLine: uint32(r.uleb128()),
+				StartCol:  uint32(r.uleb128()),
+				EndLine:   uint32(r.uleb128()),
+				EndCol:    uint32(r.uleb128()),
+				Stmts:     uint32(r.uleb128()),
+			}
+		}
+		fn.Literal = r.uleb128() != 0
+		if r.err != nil {
+			return nil, fmt.Errorf("error decoding function %d: %w", i, r.err)
+		}
+		if fn.Name, err = lookup(strs, name); err != nil {
+			return nil, err
+		}
+		if fn.File, err = lookup(strs, file); err != nil {
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
@@ -0,0 +1,35 @@
+package covdata
+
+import (
+	"math"
+
+	"golang.org/x/tools/cover"
+)
+
+// Profiles combines meta-data with the counters of one or more runs of the
+// same binary into profiles, one per source file, in the form that
+// cover.ParseProfiles returns for a text profile. Units that no counter
+// data mentions are reported with a zero count.
+func (m *Meta) Profiles(counters ...*Counters) ([]*cover.Profile, error) {
+	profile := NewProfile()
+	if err := profile.Add(m, counters...); err != nil {
+		return nil, err
+	}
+	return profile.CoverProfiles(), nil
+}
+
+// mergeCount combines the counts of a unit from two runs: in set mode a unit
+// counts as covered if any run covered it, otherwise counts are added,
+// saturating at the uint32 limit.
+func mergeCount(mode CounterMode, a, b uint32) uint32 {
+	if mode == ModeSet {
+		if a != 0 || b != 0 {
+			return 1
+		}
+		return 0
+	}
+	if sum := uint64(a) + uint64(b); sum <= math.MaxUint32 {
+		return uint32(sum)
+	}
+	return math.MaxUint32
+}
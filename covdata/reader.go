@@ -0,0 +1,112 @@
+package covdata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errShortData = errors.New("unexpected end of coverage data")
+
+// reader walks a byte slice, remembering the first error so that callers can
+// decode a whole structure and check once at the end.
+type reader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reader) seek(off int) {
+	if off < 0 || off > len(r.data) {
+		r.fail(fmt.Errorf("offset %d outside of %d bytes of coverage data", off, len(r.data)))
+		return
+	}
+	r.off = off
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.off+n > len(r.data) {
+		r.fail(errShortData)
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *reader) uint8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint32(order binary.ByteOrder) uint32 {
+	if b := r.bytes(4); b != nil {
+		return order.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) uleb128() uint64 {
+	var value uint64
+	var shift uint
+	for {
+		b := r.bytes(1)
+		if b == nil {
+			return 0
+		}
+		value |= uint64(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			return value
+		}
+		shift += 7
+		if shift >= 64 {
+			r.fail(errors.New("ULEB128 value overflows 64 bits"))
+			return 0
+		}
+	}
+}
+
+// stringTable reads a string table: a count followed by length-prefixed
+// strings, all ULEB128 encoded.
+func (r *reader) stringTable() []string {
+	n := r.uleb128()
+	if n > uint64(len(r.data)) {
+		r.fail(fmt.Errorf("string table with %d entries in %d bytes", n, len(r.data)))
+		return nil
+	}
+	strs := make([]string, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		length := r.uleb128()
+		if length > uint64(len(r.data)) {
+			r.fail(errShortData)
+			return nil
+		}
+		strs = append(strs, string(r.bytes(int(length))))
+	}
+	return strs
+}
+
+func lookup(strs []string, idx uint64) (string, error) {
+	if idx >= uint64(len(strs)) {
+		return "", fmt.Errorf("string table index %d out of range (%d entries)", idx, len(strs))
+	}
+	return strs[idx], nil
+}
@@ -0,0 +1,108 @@
+package covdata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Summary is the statement coverage of a package, file or function.
+type Summary struct {
+	Name    string
+	Covered int
+	Total   int
+}
+
+// Percent returns the covered share of statements, 0 when there are none.
+func (s Summary) Percent() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return 100 * float64(s.Covered) / float64(s.Total)
+}
+
+// Level selects what a summary is broken down by.
+type Level int
+
+const (
+	ByPackage Level = iota
+	ByFile
+	ByFunc
+)
+
+// ParseLevel accepts "pkg"/"package", "file" and "func"/"function".
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "pkg", "package":
+		return ByPackage, nil
+	case "file":
+		return ByFile, nil
+	case "func", "function":
+		return ByFunc, nil
+	}
+	return 0, fmt.Errorf("unknown summary level %q (want pkg, file or func)", s)
+}
+
+// key names the package, file or function a block belongs to. Function
+// literals count towards the function that contains them; functions are
+// qualified by their file since names repeat across packages.
+func (l Level) key(block Block) string {
+	switch l {
+	case ByFile:
+		return block.File
+	case ByFunc:
+		return block.File + ":" + block.Func
+	}
+	return block.Package
+}
+
+// Summaries breaks the profile's statement coverage down by level, sorted by
+// name.
+func (p *Profile) Summaries(level Level) []Summary {
+	return summarize(p.Blocks(), level)
+}
+
+func summarize(blocks []Block, level Level) []Summary {
+	index := make(map[string]int)
+	var summaries []Summary
+	for _, block := range blocks {
+		key := level.key(block)
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, Summary{Name: key})
+		}
+		summaries[i].Total += int(block.Stmts)
+		if block.Count > 0 {
+			summaries[i].Covered += int(block.Stmts)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// Total returns the coverage of all statements in the profile.
+func (p *Profile) Total() Summary {
+	total := Summary{Name: "total"}
+	for _, block := range p.Blocks() {
+		total.Total += int(block.Stmts)
+		if block.Count > 0 {
+			total.Covered += int(block.Stmts)
+		}
+	}
+	return total
+}
+
+// WriteText writes the profile in the text format of go test -coverprofile
+// and go tool covdata textfmt, which go tool cover reads.
+func (p *Profile) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", p.Mode)
+	for _, block := range p.Blocks() {
+		fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", block.File,
+			block.StartLine, block.StartCol, block.EndLine, block.EndCol, block.Stmts, block.Count)
+	}
+	return bw.Flush()
+}
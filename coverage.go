@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"runtime/coverage"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muskinfra/covdata"
+	"golang.org/x/tools/cover"
+)
+
+// coverageBlock is one instrumented block of the target. ID is a compact,
+// stable identifier derived from the file and position, so that clients can
+// compare block sets across calls without sending positions back and forth.
+type coverageBlock struct {
+	ID    string `json:"id"`
+	File  string `json:"file"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Stmts int    `json:"stmts"`
+	Count int    `json:"count"`
+}
+
+// coverageSummary is the statement coverage of one package, file or
+// function in the breakdown of /coverage?by=...
+type coverageSummary struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Stmt     int    `json:"stmt"`
+	Coverage string `json:"coverage"`
+}
+
+// blockBaseline is the body of POST /coverage/blocks: the IDs of the blocks
+// the client already knows about.
+type blockBaseline struct {
+	Baseline []string `json:"baseline"`
+}
+
+// fuzzHooks are the parts of the target that only exist to serve the
+// fuzzer. They are left out of coverage unless a request asks for them with
+// hooks=true.
+var fuzzHooks = []string{
+	"coverageSoFar",
+	"exitProgram",
+	"generateUser",
+	"coverage.go",
+	"attribution.go",
+	"snapshots.go",
+	"routes.go",
+	"checkpoint.go",
+	"github.com/muskinfra/covdata",
+	"github.com/muskinfra/cmd/*",
+}
+
+// coverageFilter reads the include and exclude query parameters, comma-
+// separated glob patterns that decide which functions count toward
+// coverage. See covdata.Filter for how patterns match.
+func coverageFilter(r *http.Request) (covdata.Filter, error) {
+	query := r.URL.Query()
+	filter, err := covdata.ParseFilter(query.Get("include"), query.Get("exclude"))
+	if err != nil {
+		return filter, err
+	}
+	if query.Get("hooks") != "true" {
+		filter.Exclude = append(filter.Exclude, fuzzHooks...)
+	}
+	return filter, nil
+}
+
+// readProfile decodes the current meta and counter data in memory and keeps
+// the functions filter selects.
+func readProfile(filter covdata.Filter) (*covdata.Profile, error) {
+	meta, counters, err := readCoverage()
+	if err != nil {
+		return nil, err
+	}
+	profile := covdata.NewProfile()
+	if err := profile.Add(meta, counters); err != nil {
+		return nil, err
+	}
+	return profile.Filter(filter), nil
+}
+
+// coverageBreakdown breaks the coverage of profile down by "pkg", "file" or
+// "func".
+func coverageBreakdown(profile *covdata.Profile, by string) ([]coverageSummary, error) {
+	level, err := covdata.ParseLevel(by)
+	if err != nil {
+		return nil, err
+	}
+	summaries := profile.Summaries(level)
+	breakdown := make([]coverageSummary, len(summaries))
+	for i, s := range summaries {
+		breakdown[i] = coverageSummary{
+			Name:     s.Name,
+			Count:    s.Covered,
+			Stmt:     s.Total,
+			Coverage: fmt.Sprintf("%.2f%%", s.Percent()),
+		}
+	}
+	return breakdown, nil
+}
+
+var (
+	metaOnce sync.Once
+	meta     *covdata.Meta
+	metaErr  error
+)
+
+// readMeta decodes the meta-data of this binary, which does not change
+// while it runs, once.
+func readMeta() (*covdata.Meta, error) {
+	metaOnce.Do(func() {
+		var buf bytes.Buffer
+		if metaErr = coverage.WriteMeta(&buf); metaErr != nil {
+			return
+		}
+		meta, metaErr = covdata.ReadMeta(buf.Bytes())
+	})
+	return meta, metaErr
+}
+
+// readCounters decodes the current counters of this process.
+func readCounters() (*covdata.Counters, error) {
+	var buf bytes.Buffer
+	if err := coverage.WriteCounters(&buf); err != nil {
+		return nil, err
+	}
+	return covdata.ReadCounters(buf.Bytes())
+}
+
+// readCoverage returns the meta-data and current counters of this process.
+func readCoverage() (*covdata.Meta, *covdata.Counters, error) {
+	meta, err := readMeta()
+	if err != nil {
+		return nil, nil, err
+	}
+	counters, err := readCounters()
+	if err != nil && meta.Mode != covdata.ModeAtomic {
+		// WriteCounters fails for set and count builds; the meta-data, and
+		// with it the mode, is available in every mode
+		return nil, nil, fmt.Errorf("target was built with -covermode=%s, rebuild it with -covermode=atomic: %w", meta.Mode, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return meta, counters, nil
+}
+
+// writeCoverageError answers a coverage request that failed with the error
+// and, when the meta-data can be read, the cover mode, so that a client can
+// tell a target whose counters are unavailable from one that has none.
+func writeCoverageError(w http.ResponseWriter, err error) {
+	result := map[string]interface{}{"error": err.Error()}
+	if meta, metaErr := readMeta(); metaErr == nil {
+		result["mode"] = meta.Mode.String()
+	}
+	w.WriteHeader(400)
+	json.NewEncoder(w).Encode(result)
+}
+
+// blockID hashes a block's file and position into 16 hex digits.
+func blockID(file string, block cover.ProfileBlock) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%d.%d,%d.%d", file, block.StartLine, block.StartCol, block.EndLine, block.EndCol)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// coveredBlocks lists the blocks with a non-zero count whose ID is not in
+// baseline.
+func coveredBlocks(profiles []*cover.Profile, baseline map[string]bool) []coverageBlock {
+	blocks := []coverageBlock{}
+	for _, profile := range profiles {
+		for _, block := range profile.Blocks {
+			if block.Count == 0 {
+				continue
+			}
+			id := blockID(profile.FileName, block)
+			if baseline[id] {
+				continue
+			}
+			blocks = append(blocks, coverageBlock{
+				ID:    id,
+				File:  profile.FileName,
+				Start: fmt.Sprintf("%d.%d", block.StartLine, block.StartCol),
+				End:   fmt.Sprintf("%d.%d", block.EndLine, block.EndCol),
+				Stmts: block.NumStmt,
+				Count: block.Count,
+			})
+		}
+	}
+	return blocks
+}
+
+// coverageBlocks lists every covered block. A POST with a baseline of block
+// IDs returns only the blocks that are not in it. A since cursor, taken
+// from the cursor field of an earlier response, returns only the blocks
+// first covered after that response, so a client need not send back every
+// block it knows.
+func coverageBlocks(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Called CoverageBlocks")
+	w.Header().Set("Content-Type", "application/json")
+	baseline := make(map[string]bool)
+	if r.Method == http.MethodPost {
+		var body blockBaseline
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(err.Error())
+			return
+		}
+		for _, id := range body.Baseline {
+			baseline[id] = true
+		}
+	}
+
+	filter, err := coverageFilter(r)
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	profile, err := readProfile(filter)
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+
+	blocks, cursor := blocksSince(r.URL.Query(), coveredBlocks(profile.CoverProfiles(), nil))
+	result := make(map[string]interface{})
+	result["mode"] = profile.Mode.String()
+	result["blocks"] = withoutBaseline(blocks, baseline)
+	result["cursor"] = cursor
+	json.NewEncoder(w).Encode(result)
+}
+
+// blockLog numbers the blocks of one filter in the order they were first
+// seen covered. Blocks stay in it after a reset, so a cursor never returns
+// a block twice.
+type blockLog struct {
+	index map[string]int
+}
+
+var (
+	blockLogsMu sync.Mutex
+	blockLogs   = make(map[string]*blockLog)
+	// blockLogEpoch tells the cursors of this process from those of one
+	// that ran before a restart.
+	blockLogEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+)
+
+// blocksSince logs the covered blocks that are new to the log of the
+// request's filter and returns those logged after the query's since cursor,
+// with the cursor for the next request. Without a cursor, or with one of an
+// earlier process, it returns every covered block.
+func blocksSince(query url.Values, covered []coverageBlock) ([]coverageBlock, string) {
+	key := query.Get("include") + "\x00" + query.Get("exclude") + "\x00" + strconv.FormatBool(query.Get("hooks") == "true")
+	blockLogsMu.Lock()
+	defer blockLogsMu.Unlock()
+	log := blockLogs[key]
+	if log == nil {
+		log = &blockLog{index: make(map[string]int)}
+		blockLogs[key] = log
+	}
+	for _, block := range covered {
+		if _, ok := log.index[block.ID]; !ok {
+			log.index[block.ID] = len(log.index)
+		}
+	}
+	cursor := fmt.Sprintf("%s.%d", blockLogEpoch, len(log.index))
+
+	since := 0
+	if epoch, n, ok := strings.Cut(query.Get("since"), "."); ok && epoch == blockLogEpoch {
+		since, _ = strconv.Atoi(n)
+	}
+	if since == 0 {
+		return covered, cursor
+	}
+	blocks := []coverageBlock{}
+	for _, block := range covered {
+		if log.index[block.ID] >= since {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, cursor
+}
+
+// withoutBaseline drops the blocks whose IDs are in baseline.
+func withoutBaseline(blocks []coverageBlock, baseline map[string]bool) []coverageBlock {
+	if len(baseline) == 0 {
+		return blocks
+	}
+	kept := []coverageBlock{}
+	for _, block := range blocks {
+		if !baseline[block.ID] {
+			kept = append(kept, block)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/muskinfra/covdata"
+	"golang.org/x/tools/cover"
+)
+
+func TestCoveredBlocksBaseline(t *testing.T) {
+	profiles := []*cover.Profile{{
+		FileName: "github.com/muskinfra/main.go",
+		Mode:     "atomic",
+		Blocks: []cover.ProfileBlock{
+			{StartLine: 31, StartCol: 31, EndLine: 33, EndCol: 2, NumStmt: 1, Count: 2},
+			{StartLine: 37, StartCol: 27, EndLine: 40, EndCol: 3, NumStmt: 1, Count: 0},
+			{StartLine: 42, StartCol: 2, EndLine: 42, EndCol: 19, NumStmt: 1, Count: 1},
+		},
+	}}
+
+	blocks := coveredBlocks(profiles, nil)
+	if len(blocks) != 2 {
+		t.Fatalf("wrong number of covered blocks: got %d want %d", len(blocks), 2)
+	}
+	if blocks[0].Start != "31.31" || blocks[0].End != "33.2" || blocks[0].Count != 2 {
+		t.Errorf("unexpected block: %+v", blocks[0])
+	}
+	if blocks[0].ID == blocks[1].ID {
+		t.Errorf("different blocks share the ID %s", blocks[0].ID)
+	}
+
+	newBlocks := coveredBlocks(profiles, map[string]bool{blocks[0].ID: true})
+	if len(newBlocks) != 1 || newBlocks[0].ID != blocks[1].ID {
+		t.Errorf("baseline block not filtered: got %+v", newBlocks)
+	}
+}
+
+func TestBlocksSince(t *testing.T) {
+	query := url.Values{"include": {"blocks-since-test"}}
+	all, cursor := blocksSince(query, []coverageBlock{{ID: "a"}, {ID: "b"}})
+	if len(all) != 2 {
+		t.Fatalf("want every block without a cursor, got %+v", all)
+	}
+
+	query.Set("since", cursor)
+	blocks, next := blocksSince(query, []coverageBlock{{ID: "a"}, {ID: "c"}, {ID: "b"}})
+	if len(blocks) != 1 || blocks[0].ID != "c" || next == cursor {
+		t.Errorf("want only c after %s, got %+v and %s", cursor, blocks, next)
+	}
+	query.Set("since", next)
+	if blocks, _ := blocksSince(query, []coverageBlock{{ID: "a"}, {ID: "b"}, {ID: "c"}}); len(blocks) != 0 {
+		t.Errorf("logged blocks returned again: %+v", blocks)
+	}
+
+	// a cursor of another process starts over
+	query.Set("since", "0.1")
+	if blocks, _ := blocksSince(query, []coverageBlock{{ID: "a"}, {ID: "c"}}); len(blocks) != 2 {
+		t.Errorf("foreign cursor not ignored: %+v", blocks)
+	}
+}
+
+func TestRequestCoverageEviction(t *testing.T) {
+	c := &requestCoverage{blocks: make(map[string][]covdata.Block)}
+	for i := 0; i <= maxAttributedRequests; i++ {
+		c.add(strconv.Itoa(i), []covdata.Block{{Func: "b"}})
+	}
+	if _, ok := c.get("0"); ok {
+		t.Error("oldest request was not evicted")
+	}
+	if blocks, ok := c.get(strconv.Itoa(maxAttributedRequests)); !ok || len(blocks) != 1 {
+		t.Errorf("newest request missing: %v", blocks)
+	}
+}
+
+func TestRequestCoverageHonorsFilter(t *testing.T) {
+	hook := covdata.Block{Package: "github.com/muskinfra", ModulePath: "github.com/muskinfra", Func: "exitProgram", File: "github.com/muskinfra/main.go", Count: 1}
+	handler := covdata.Block{Package: "github.com/muskinfra", ModulePath: "github.com/muskinfra", Func: "getUser", File: "github.com/muskinfra/main.go", Count: 3}
+	handler.StartLine = 10
+	attributed.add("filtered", []covdata.Block{hook, handler})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/coverage/requests/{id}", requestCoverageSoFar)
+	for query, want := range map[string]int{"": 1, "?hooks=true": 2, "?exclude=getUser": 0} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/coverage/requests/filtered"+query, nil))
+		var result struct{ Blocks []coverageBlock }
+		if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Blocks) != want {
+			t.Errorf("%q: want %d blocks, got %+v", query, want, result.Blocks)
+		}
+	}
+}
+
+func TestAttributeCoverageServesRequest(t *testing.T) {
+	// test binaries have no coverage counters unless built with -cover,
+	// the request must be served either way
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(requestIDHeader, "r1")
+
+	rr := httptest.NewRecorder()
+	attributeCoverage(http.HandlerFunc(serveHome)).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+}
+
+func TestPruneSnapshotsKeepsNewest(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("COVERAGE_SNAPSHOT_DIR", dir)
+	start := time.Now().Add(-time.Hour)
+	for i, name := range []string{"after-seed", "after-1h", "after-2h"} {
+		path := filepath.Join(dir, name)
+		if err := os.Mkdir(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		taken := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, taken, taken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, ".after-3h-123"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pruneSnapshots(2); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := listSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != "after-1h" || snapshots[1].Name != "after-2h" {
+		t.Errorf("wrong snapshots kept: %+v", snapshots)
+	}
+}
+
+func TestLoadSnapshotRejectsPaths(t *testing.T) {
+	t.Setenv("COVERAGE_SNAPSHOT_DIR", t.TempDir())
+	for _, name := range []string{"../cover", "..", ".", "a/b", "a b"} {
+		if _, err := loadSnapshot(name, covdata.Filter{}); err == nil || !strings.Contains(err.Error(), "invalid snapshot name") {
+			t.Errorf("snapshot name %q not rejected: %v", name, err)
+		}
+	}
+}
+
+func TestCoverageFilterExcludesFuzzHooks(t *testing.T) {
+	hook := covdata.Block{Package: "github.com/muskinfra", ModulePath: "github.com/muskinfra", Func: "exitProgram", File: "github.com/muskinfra/main.go"}
+	handler := covdata.Block{Package: "github.com/muskinfra", ModulePath: "github.com/muskinfra", Func: "getUser", File: "github.com/muskinfra/main.go"}
+
+	req := httptest.NewRequest("GET", "/coverage?exclude=get*", nil)
+	filter, err := coverageFilter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Match(hook) || filter.Match(handler) {
+		t.Errorf("filter %+v kept an excluded function", filter)
+	}
+
+	req = httptest.NewRequest("GET", "/coverage?hooks=true", nil)
+	if filter, err = coverageFilter(req); err != nil {
+		t.Fatal(err)
+	}
+	if !filter.Match(hook) || !filter.Match(handler) {
+		t.Errorf("filter %+v dropped a function although hooks were asked for", filter)
+	}
+}
+
+func TestCoverFuncName(t *testing.T) {
+	for name, want := range map[string]string{
+		"main.getUser":                     "getUser",
+		"main.(*User).IsEmpty":             "*User.IsEmpty",
+		"main.SetupSwagger.func1":          "SetupSwagger",
+		"github.com/muskinfra/x.f.func2.1": "f",
+		"main.(*requestCoverage).add-fm":   "*requestCoverage.add",
+	} {
+		if got := coverFuncName(name); got != want {
+			t.Errorf("coverFuncName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRouteReports(t *testing.T) {
+	meta := &covdata.Meta{Mode: covdata.ModeSet, Packages: []*covdata.Package{{
+		Path:       "github.com/muskinfra",
+		ModulePath: "github.com/muskinfra",
+		Funcs: []covdata.Func{
+			{Name: "getUser", File: "github.com/muskinfra/main.go", Units: []covdata.Unit{{StartLine: 120, StartCol: 2, EndLine: 122, EndCol: 3, Stmts: 2}, {StartLine: 124, StartCol: 2, EndLine: 125, EndCol: 10, Stmts: 1}}},
+			{Name: "deleteUser", File: "github.com/muskinfra/main.go", Units: []covdata.Unit{{StartLine: 140, StartCol: 2, EndLine: 141, EndCol: 3, Stmts: 1}}},
+		},
+	}}}
+	counters := &covdata.Counters{Funcs: []covdata.FuncCounters{{Func: 0, Counters: []uint32{1, 0}}}}
+	profile := covdata.NewProfile()
+	if err := profile.Add(meta, counters); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/user/{id}", getUser).Methods("GET", "HEAD")
+	r.HandleFunc("/user/{id}", deleteUser).Methods("DELETE")
+	r.HandleFunc("/users", getAllUsers).Methods("GET")
+	reports, err := routeReports(r, profile, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("wrong number of routes: %+v", reports)
+	}
+	get := reports[0]
+	if get.Method != "GET" || get.Path != "/user/{id}" || get.Handler != "getUser" || get.Count != 2 || get.Stmt != 3 {
+		t.Errorf("wrong report for GET /user/{id}: %+v", get)
+	}
+	if get.Source != "github.com/muskinfra/main.go:120-125" || len(get.Missed) != 1 || get.Missed[0].Position != "github.com/muskinfra/main.go:124.2,125.10" {
+		t.Errorf("wrong source or missed blocks: %+v", get)
+	}
+	if reports[1].Method != "HEAD" || reports[2].Handler != "deleteUser" || reports[2].Count != 0 {
+		t.Errorf("wrong reports: %+v", reports[1:])
+	}
+}
+
+func TestCheckpointInterval(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":      defaultCheckpointInterval,
+		"10s":   10 * time.Second,
+		"0":     0,
+		"often": defaultCheckpointInterval,
+	} {
+		t.Setenv("COVERAGE_CHECKPOINT_INTERVAL", value)
+		if got := checkpointInterval(); got != want {
+			t.Errorf("COVERAGE_CHECKPOINT_INTERVAL=%q: got %v want %v", value, got, want)
+		}
+	}
+}
+
+func TestCheckpointLeavesNoPartialFiles(t *testing.T) {
+	// test binaries have no counters unless built with -cover, in which
+	// case the write fails before touching the directory
+	dir := t.TempDir()
+	c := &checkpointer{dir: dir, file: "covcounters.00.1.1"}
+	err := c.write()
+	entries, _ := os.ReadDir(dir)
+	if err != nil && len(entries) != 0 {
+		t.Errorf("failed checkpoint left files behind: %v", entries)
+	}
+	if err == nil && (len(entries) != 1 || entries[0].Name() != c.file) {
+		t.Errorf("checkpoint wrote unexpected files: %v", entries)
+	}
+}
@@ -8,17 +8,13 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
-	"os/exec"
 	"reflect"
-	"runtime/coverage"
 	"strconv"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/leanovate/gopter/arbitrary"
 	httpSwagger "github.com/swaggo/http-swagger"
-	"golang.org/x/tools/cover"
 )
 
 type User struct {
@@ -84,8 +80,20 @@ func main() {
 	// Additional hooks for fuzzing?
 	r.HandleFunc("/exit", exitProgram).Methods("GET")
 	r.HandleFunc("/coverage", coverageSoFar).Methods("GET")
+	r.HandleFunc("/coverage/blocks", coverageBlocks).Methods("GET", "POST")
+	r.HandleFunc("/coverage/requests/{id}", requestCoverageSoFar).Methods("GET")
+	r.HandleFunc("/coverage/reset", resetCoverage).Methods("POST")
+	r.HandleFunc("/coverage/snapshots", snapshotsSoFar).Methods("GET")
+	r.HandleFunc("/coverage/snapshots/diff", diffSnapshots).Methods("GET")
+	r.HandleFunc("/coverage/snapshots/{name}", takeSnapshot).Methods("POST")
+	r.HandleFunc("/coverage/uncovered", uncoveredSoFar).Methods("GET")
+	r.HandleFunc("/coverage/routes", routeCoverageSoFar(r)).Methods("GET")
+	r.Use(attributeCoverage)
 	r.HandleFunc("/generate", generateUser).Methods("GET")
 
+	// keep coverage on disk while running, in case the target crashes
+	startCheckpointing()
+
 	// Setup Swagger
 	swaggerEndPoint := "/docs/swagger.json"
 	router, err := SetupSwagger(r, swaggerEndPoint)
@@ -140,61 +148,43 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 
 func exitProgram(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Calling Exit")
+	if checkpoints != nil {
+		if err := checkpoints.final(); err != nil {
+			fmt.Println("Error checkpointing coverage:", err)
+		}
+	}
 	os.Exit(0)
 }
 
 func coverageSoFar(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Called CoverageSoFar")
-	covDir := uuid.NewString()
-	if err := os.MkdirAll(fmt.Sprintf("./%s", covDir), os.ModePerm); err != nil {
-		w.WriteHeader(400)
-		json.NewEncoder(w).Encode(err.Error())
-		return
-	}
-	if err := coverage.WriteMetaDir(covDir); err != nil {
-		w.WriteHeader(400)
-		json.NewEncoder(w).Encode(err.Error())
-		return
-	}
-	if err := coverage.WriteCountersDir(covDir); err != nil {
-		w.WriteHeader(400)
-		json.NewEncoder(w).Encode(err.Error())
-		return
-	}
-	profileOutputFile := fmt.Sprintf("profile_%s.txt", covDir)
-	covDataCmd := exec.Command("go", "tool", "covdata", "textfmt", "-i", covDir, "-o", profileOutputFile)
-	if err := covDataCmd.Run(); err != nil {
+	filter, err := coverageFilter(r)
+	if err != nil {
 		w.WriteHeader(400)
 		json.NewEncoder(w).Encode(err.Error())
 		return
 	}
-
-	profiles, err := cover.ParseProfiles(profileOutputFile)
+	profile, err := readProfile(filter)
 	if err != nil {
-		w.WriteHeader(400)
-		json.NewEncoder(w).Encode(err.Error())
+		writeCoverageError(w, err)
 		return
 	}
 
-	// cleanup the cov dir and profile file
-	defer os.RemoveAll(covDir)
-	defer os.Remove(profileOutputFile)
-
-	coveredStmt := 0
-	totalStmt := 0
-	for _, profile := range profiles {
-		for _, block := range profile.Blocks {
-			if block.Count > 0 {
-				coveredStmt += block.NumStmt
-			}
-			totalStmt += block.NumStmt
+	total := profile.Total()
+	result := make(map[string]interface{})
+	result["count"] = total.Covered
+	result["stmt"] = total.Total
+	result["coverage"] = fmt.Sprintf("%.2f%%", total.Percent())
+	result["mode"] = profile.Mode.String()
+	if by := r.URL.Query().Get("by"); by != "" {
+		breakdown, err := coverageBreakdown(profile, by)
+		if err != nil {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(err.Error())
+			return
 		}
+		result["breakdown"] = breakdown
 	}
-
-	result := make(map[string]interface{})
-	result["count"] = coveredStmt
-	result["stmt"] = totalStmt
-	result["coverage"] = fmt.Sprintf("%.2f%%", (100 * float64(coveredStmt) / float64(totalStmt)))
 	json.NewEncoder(w).Encode(result)
 }
 
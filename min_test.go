@@ -87,7 +87,7 @@ func TestCreateUser(t *testing.T) {
 	}
 
 	
-	if createdUser.ID == "" {
+	if createdUser.ID == 0 {
 		t.Error("user ID is empty")
 	}
 
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// baseEnergy is how many mutants of a corpus entry of average size and speed
+// are run in a row once the entry is picked; maxEnergy caps it.
+const (
+	baseEnergy = 4
+	maxEnergy  = 32
+)
+
+// banditArm is one arm of a multi-armed bandit: how often it was played and
+// how often that paid off, i.e. covered new blocks or hit counts, got a
+// status code not seen before from an operation, or produced a finding.
+type banditArm struct {
+	Name    string `json:"name"`
+	Pulls   int    `json:"pulls"`
+	Rewards int    `json:"rewards"`
+}
+
+// ucb1 scores an arm that was pulled pulls times with rewards successes,
+// out of total pulls of all arms: its mean reward plus an exploration bonus
+// that shrinks the more it is played relative to the others. Arms that were
+// never played score +Inf, so every arm is tried once before any is
+// favoured.
+func ucb1(pulls, rewards, total int) float64 {
+	if pulls == 0 {
+		return math.Inf(1)
+	}
+	return float64(rewards)/float64(pulls) + math.Sqrt(2*math.Log(float64(total))/float64(pulls))
+}
+
+// operationBandit decides which operations fresh sequences and inserted
+// steps are built from. Every operation is an arm, scored with UCB1, so
+// attention goes to operations that still produce unseen behaviour rather
+// than being spread evenly.
+type operationBandit struct {
+	arms  []banditArm
+	total int
+	// statuses holds the status codes seen per operation, as
+	// "<operation> <code>".
+	statuses map[string]bool
+}
+
+func newOperationBandit(endpoints []EndpointInfo) *operationBandit {
+	b := &operationBandit{arms: make([]banditArm, len(endpoints)), statuses: make(map[string]bool)}
+	for i, endpoint := range endpoints {
+		b.arms[i].Name = operationName(endpoint)
+	}
+	return b
+}
+
+// choose returns the candidate with the highest score, counting the steps
+// of seq as pulls already, so that one sequence does not repeat the same
+// untried operation. Ties are broken at random.
+func (b *operationBandit) choose(candidates, seq []int) int {
+	best, bestScore := candidates[0], math.Inf(-1)
+	for _, i := range rand.Perm(len(candidates)) {
+		op := candidates[i]
+		pulls := b.arms[op].Pulls
+		for _, prior := range seq {
+			if prior == op {
+				pulls++
+			}
+		}
+		if score := ucb1(pulls, b.arms[op].Rewards, b.total+len(seq)); score > bestScore {
+			best, bestScore = op, score
+		}
+	}
+	return best
+}
+
+// newStatus records the status code an operation answered with and reports
+// whether the operation never answered with it before.
+func (b *operationBandit) newStatus(operation string, statusCode int) bool {
+	key := operation + " " + strconv.Itoa(statusCode)
+	if b.statuses[key] {
+		return false
+	}
+	b.statuses[key] = true
+	return true
+}
+
+// play records one pull of the arm of op.
+func (b *operationBandit) play(op int, paid bool) {
+	b.arms[op].Pulls++
+	b.total++
+	if paid {
+		b.arms[op].Rewards++
+	}
+}
+
+// rewardOperations plays the arm of every step of a sequence that was run.
+// A step pays off when it got a new status code, covered one of the blocks
+// in found or produced a finding. When the target does not attribute blocks
+// to requests, new blocks pay off for every step of the sequence. It returns
+// the number of new status codes.
+func (f *fuzzer) rewardOperations(sent []requestInput, statusCodes []int, found []string, reported []int) int {
+	isNew := make(map[string]bool, len(found))
+	for _, id := range found {
+		isNew[id] = true
+	}
+	attributed := false
+	for _, input := range sent {
+		attributed = attributed || len(input.Reached) > 0
+	}
+	finding := make(map[int]bool, len(reported))
+	for _, step := range reported {
+		finding[step] = true
+	}
+
+	newStatuses := 0
+	for step, input := range sent {
+		paid := finding[step] || (!attributed && len(found) > 0)
+		if f.operations.newStatus(input.Operation, statusCodes[step]) {
+			newStatuses++
+			paid = true
+		}
+		for _, id := range input.Reached {
+			paid = paid || isNew[id]
+		}
+		f.operations.play(input.Op, paid)
+	}
+	return newStatuses
+}
+
+// averages returns the average number of blocks the entries of c
+// reached and of requests they send, the yardsticks for energy.
+func (c *corpus) averages() (blocks, requests float64) {
+	if len(c.entries) == 0 {
+		return 0, 0
+	}
+	for _, entry := range c.entries {
+		blocks += float64(entry.reached())
+		requests += float64(len(entry.Inputs))
+	}
+	n := float64(len(c.entries))
+	return blocks / n, requests / n
+}
+
+// reached returns the number of distinct blocks the steps of e reached.
+func (e *corpusEntry) reached() int {
+	blocks := make(map[string]bool)
+	for _, input := range e.Inputs {
+		for _, id := range input.Reached {
+			blocks[id] = true
+		}
+	}
+	return len(blocks)
+}
+
+// energy returns how many mutants of e are run in a row, following AFL's
+// performance score: entries that reach more blocks than the average get
+// more, entries that send more requests than the average, and so take
+// longer, get less, and entries deep down a chain of mutants get more, as
+// they have had fewer chances so far.
+func (e *corpusEntry) energy(avgBlocks, avgRequests float64) int {
+	score := float64(baseEnergy)
+
+	if blocks := float64(e.reached()); avgBlocks > 0 {
+		switch {
+		case blocks*0.3 > avgBlocks:
+			score *= 3
+		case blocks*0.5 > avgBlocks:
+			score *= 2
+		case blocks*0.75 > avgBlocks:
+			score *= 1.5
+		case blocks*3 < avgBlocks:
+			score *= 0.25
+		case blocks*2 < avgBlocks:
+			score *= 0.5
+		case blocks*1.5 < avgBlocks:
+			score *= 0.75
+		}
+	}
+
+	if requests := float64(len(e.Inputs)); avgRequests > 0 {
+		switch {
+		case requests*0.5 > avgRequests:
+			score *= 0.5
+		case requests*0.75 > avgRequests:
+			score *= 0.75
+		case requests*2 < avgRequests:
+			score *= 2
+		case requests*1.5 < avgRequests:
+			score *= 1.5
+		}
+	}
+
+	switch {
+	case e.Depth >= 25:
+		score *= 5
+	case e.Depth >= 14:
+		score *= 4
+	case e.Depth >= 8:
+		score *= 3
+	case e.Depth >= 4:
+		score *= 2
+	}
+
+	return int(math.Max(1, math.Min(score, maxEnergy)))
+}
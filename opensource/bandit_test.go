@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUCB1(t *testing.T) {
+	if !math.IsInf(ucb1(0, 0, 10), 1) {
+		t.Error("untried arm does not score +Inf")
+	}
+	if ucb1(10, 5, 100) <= ucb1(10, 1, 100) {
+		t.Error("better arm does not score higher")
+	}
+	if ucb1(2, 1, 100) <= ucb1(50, 25, 100) {
+		t.Error("rarely played arm gets no exploration bonus")
+	}
+}
+
+func TestOperationBanditChoose(t *testing.T) {
+	g := sampleGraph(t)
+	b := newOperationBandit(g.endpoints)
+	all := make([]int, len(g.endpoints))
+	for i := range all {
+		all[i] = i
+	}
+
+	// every operation is tried once before any is repeated
+	tried := make(map[int]bool)
+	var seq []int
+	for range all {
+		op := b.choose(all, seq)
+		if tried[op] {
+			t.Fatalf("%s chosen twice before all were tried", b.arms[op].Name)
+		}
+		tried[op] = true
+		seq = append(seq, op)
+	}
+
+	for i := 0; i < 100; i++ {
+		for op := range all {
+			b.play(op, op == 0 && i%2 == 0)
+		}
+	}
+	counts := make(map[int]int)
+	for i := 0; i < 50; i++ {
+		op := b.choose(all, nil)
+		counts[op]++
+		b.play(op, false)
+	}
+	if counts[0] < 25 {
+		t.Errorf("paying operation chosen only %d of 50 times: %v", counts[0], counts)
+	}
+}
+
+func TestRewardOperations(t *testing.T) {
+	g := sampleGraph(t)
+	f := newFuzzer(g, &corpus{}, 3)
+	sent := []requestInput{
+		{Op: 0, Operation: operationName(g.endpoints[0]), Reached: []string{"a"}},
+		{Op: 1, Operation: operationName(g.endpoints[1]), Reached: []string{"b"}},
+	}
+	if n := f.rewardOperations(sent, []int{200, 200}, nil, nil); n != 2 {
+		t.Errorf("want 2 new status codes, got %d", n)
+	}
+	if n := f.rewardOperations(sent, []int{200, 404}, []string{"b"}, nil); n != 1 {
+		t.Errorf("want 1 new status code, got %d", n)
+	}
+	f.rewardOperations(sent, []int{200, 404}, []string{"a"}, nil)
+	f.rewardOperations(sent, []int{200, 404}, nil, []int{1})
+
+	if arm := f.operations.arms[0]; arm.Pulls != 4 || arm.Rewards != 2 {
+		t.Errorf("first operation: %+v", arm)
+	}
+	if arm := f.operations.arms[1]; arm.Pulls != 4 || arm.Rewards != 3 {
+		t.Errorf("second operation: %+v", arm)
+	}
+
+	// without attribution new blocks pay off for every step
+	sent[0].Reached, sent[1].Reached = nil, nil
+	f.rewardOperations(sent, []int{200, 404}, []string{"c"}, nil)
+	if f.operations.arms[0].Rewards != 3 || f.operations.arms[1].Rewards != 4 {
+		t.Errorf("unattributed blocks not rewarded: %+v", f.operations.arms[:2])
+	}
+}
+
+func TestEnergy(t *testing.T) {
+	steps := func(n int, reached ...string) []requestInput {
+		inputs := make([]requestInput, n)
+		inputs[0].Reached = reached
+		return inputs
+	}
+	average := &corpusEntry{Inputs: steps(4, "a", "b", "c", "d")}
+	if e := average.energy(4, 4); e != baseEnergy {
+		t.Errorf("average entry has energy %d", e)
+	}
+	wide := &corpusEntry{Inputs: steps(4, "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n")}
+	if e := wide.energy(4, 4); e <= baseEnergy {
+		t.Errorf("entry reaching more blocks has energy %d", e)
+	}
+	long := &corpusEntry{Inputs: steps(12, "a", "b", "c", "d")}
+	if e := long.energy(4, 4); e >= baseEnergy {
+		t.Errorf("slower entry has energy %d", e)
+	}
+	deep := &corpusEntry{Inputs: steps(4, "a", "b", "c", "d"), Depth: 30}
+	if e := deep.energy(4, 4); e != 5*baseEnergy {
+		t.Errorf("deep entry has energy %d", e)
+	}
+	if e := (&corpusEntry{Inputs: steps(40)}).energy(100, 4); e != 1 {
+		t.Errorf("energy below 1: %d", e)
+	}
+}
@@ -0,0 +1,819 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exploreChance is how often the fuzzer generates a fresh sequence instead
+// of mutating one from the corpus.
+const exploreChance = 0.2
+
+// maxMutations bounds how many mutations are stacked onto one corpus entry
+// before it is replayed.
+const maxMutations = 4
+
+// coverageQuery holds the by, include and exclude parameters sent with
+// every coverage request, so that the reported percentage and the blocks
+// that count as new agree on what is measured.
+var coverageQuery = url.Values{}
+
+// coverageReport is the answer of the target's /coverage endpoint.
+type coverageReport struct {
+	Count     int               `json:"count"`
+	Stmt      int               `json:"stmt"`
+	Coverage  string            `json:"coverage"`
+	Mode      string            `json:"mode"`
+	Breakdown []coverageSummary `json:"breakdown,omitempty"`
+}
+
+// coverageSummary is one package, file or function of a coverage breakdown.
+type coverageSummary struct {
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+	Stmt     int    `json:"stmt"`
+	Coverage string `json:"coverage"`
+}
+
+// routeCoverage is the coverage of the handler of one route and method, as
+// listed by /coverage/routes.
+type routeCoverage struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Handler  string `json:"handler"`
+	Count    int    `json:"count"`
+	Stmt     int    `json:"stmt"`
+	Coverage string `json:"coverage"`
+	Missed   []struct {
+		Position string `json:"position"`
+	} `json:"missed"`
+}
+
+// coverageURL returns the URL of a coverage endpoint with coverageQuery.
+func coverageURL(path string) string {
+	if len(coverageQuery) == 0 {
+		return baseURL + path
+	}
+	return baseURL + path + "?" + coverageQuery.Encode()
+}
+
+// coverageBlock is a covered block as listed by /coverage/blocks.
+type coverageBlock struct {
+	ID    string `json:"id"`
+	File  string `json:"file"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Stmts int    `json:"stmts"`
+	Count int    `json:"count"`
+}
+
+// corpusEntry is a request sequence that reached blocks no earlier
+// sequence had reached.
+type corpusEntry struct {
+	Inputs []requestInput `json:"inputs"`
+	// Blocks lists the IDs of the blocks the entry covered first.
+	Blocks []string `json:"blocks"`
+	// Hits counts the hit-count buckets the entry reached first.
+	Hits int `json:"hits,omitempty"`
+	// Depth counts the corpus entries the entry descends from by mutation.
+	Depth int `json:"depth,omitempty"`
+
+	// picks counts how often the entry was mutated, finds how often one of
+	// its mutants paid off. Together they make the entry's bandit arm.
+	picks int
+	finds int
+}
+
+// corpus holds the interesting sequences of a campaign. When dir is set,
+// every entry is also written there as JSON, so that a later run can start
+// from it.
+type corpus struct {
+	entries []*corpusEntry
+	dir     string
+	// last is the highest file number in dir. Entries dropped on load
+	// keep their files, so it can be above len(entries).
+	last int
+}
+
+// fuzzer runs the coverage-guided loop: sequences that cover blocks of the
+// target that were not covered before go into the corpus, and later
+// iterations replay mutated versions of them.
+type fuzzer struct {
+	graph          *dependencyGraph
+	corpus         *corpus
+	sequenceLength int
+	// seen holds the IDs of all blocks covered so far, cursor where the
+	// target's log of them ended at the last look.
+	seen   map[string]bool
+	cursor string
+	// hits holds the hit-count buckets single requests reached per block.
+	// When hitCounts is set, a sequence that puts a block into a new bucket
+	// is as interesting as one that covers a new block.
+	hits      hitMap
+	hitCounts bool
+	// coverage is cleared for targets whose counters cannot be read; the
+	// fuzzer then goes by status codes and findings alone.
+	coverage bool
+	// acceptedGarbage holds the operations and malformations already
+	// reported as accepted.
+	acceptedGarbage map[string]bool
+	scheduler       *operatorScheduler
+	operations      *operationBandit
+	oracle          *oracle
+	// current is the corpus entry being mutated, energy the number of
+	// mutants of it still to run.
+	current *corpusEntry
+	energy  int
+	// iterations counts the sequences run, findings the problems
+	// reported.
+	iterations int
+	findings   int
+}
+
+// coverageClient returns the client for the coverage endpoints, which must
+// answer within -timeout like the requests under test.
+func coverageClient() *http.Client {
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// fetchCoverage asks the target for its statement coverage so far.
+func fetchCoverage() (coverageReport, error) {
+	var report coverageReport
+	req, err := http.NewRequest("GET", coverageURL("/coverage"), nil)
+	if err != nil {
+		return report, err
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := coverageClient().Do(req)
+	if err != nil {
+		return report, fmt.Errorf("error getting coverage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return report, fmt.Errorf("error reading coverage response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// a target whose counters cannot be read still reports its mode
+		json.Unmarshal(body, &report)
+		return report, fmt.Errorf("coverage request failed with %s: %s", resp.Status, body)
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return report, fmt.Errorf("error decoding coverage response: %w", err)
+	}
+	return report, nil
+}
+
+// fetchRouteCoverage asks the target for the coverage of each route's
+// handler.
+func fetchRouteCoverage() ([]routeCoverage, error) {
+	req, err := http.NewRequest("GET", coverageURL("/coverage/routes"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := coverageClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting route coverage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading route coverage: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("route coverage request failed with %s: %s", resp.Status, body)
+	}
+	var result struct {
+		Routes []routeCoverage `json:"routes"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error decoding route coverage: %w", err)
+	}
+	return result.Routes, nil
+}
+
+// fetchNewBlocks asks the target for the blocks first covered after the
+// response that returned cursor, all covered blocks for an empty cursor,
+// and returns them with the cursor for the next call. The target keeps the
+// log the cursor points into, so the request stays small however much the
+// campaign has covered.
+func fetchNewBlocks(cursor string) ([]coverageBlock, string, error) {
+	u, err := url.Parse(coverageURL("/coverage/blocks"))
+	if err != nil {
+		return nil, "", err
+	}
+	if cursor != "" {
+		query := u.Query()
+		query.Set("since", cursor)
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := coverageClient().Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting covered blocks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading covered blocks: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("covered blocks request failed with %s: %s", resp.Status, body)
+	}
+	var result struct {
+		Blocks []coverageBlock `json:"blocks"`
+		Cursor string          `json:"cursor"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, "", fmt.Errorf("error decoding covered blocks: %w", err)
+	}
+	return result.Blocks, result.Cursor, nil
+}
+
+// fetchRequestBlocks asks the target for the blocks covered by the request
+// sent with the given ID.
+func fetchRequestBlocks(id string) ([]coverageBlock, error) {
+	req, err := http.NewRequest("GET", coverageURL("/coverage/requests/"+url.PathEscape(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := coverageClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting request coverage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading request coverage: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request coverage for %s failed with %s: %s", id, resp.Status, body)
+	}
+	var result struct {
+		Blocks []coverageBlock `json:"blocks"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error decoding request coverage: %w", err)
+	}
+	return result.Blocks, nil
+}
+
+// loadCorpus reads the entries saved in dir, creating it if needed.
+// Operations that no longer exist in the spec are dropped from the loaded
+// sequences.
+func loadCorpus(dir string, endpoints []EndpointInfo) (*corpus, error) {
+	c := &corpus{dir: dir}
+	if dir == "" {
+		return c, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	ops := make(map[string]int, len(endpoints))
+	for i, endpoint := range endpoints {
+		ops[operationName(endpoint)] = i
+	}
+	for _, file := range files {
+		if n, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file), ".json")); err == nil && n > c.last {
+			c.last = n
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entry corpusEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("error decoding corpus entry %s: %w", file, err)
+		}
+		inputs := entry.Inputs[:0]
+		for _, input := range entry.Inputs {
+			if op, ok := ops[input.Operation]; ok {
+				input.Op = op
+				if input.Params == nil {
+					input.Params = make(map[string]interface{})
+				}
+				inputs = append(inputs, input)
+			}
+		}
+		if len(inputs) > 0 {
+			entry.Inputs = inputs
+			c.entries = append(c.entries, &entry)
+		}
+	}
+	return c, nil
+}
+
+// add appends entry to the corpus and saves it.
+func (c *corpus) add(entry *corpusEntry) error {
+	c.entries = append(c.entries, entry)
+	if c.dir == "" {
+		return nil
+	}
+	c.last++
+	return writeJSONFile(entry, filepath.Join(c.dir, fmt.Sprintf("%06d.json", c.last)))
+}
+
+// pick chooses the entry with the highest UCB1 score: entries never
+// mutated come first, then those whose mutants keep paying off, while
+// entries picked often without result fade out.
+func (c *corpus) pick() *corpusEntry {
+	total := 0
+	for _, entry := range c.entries {
+		total += entry.picks
+	}
+	var best *corpusEntry
+	bestScore := math.Inf(-1)
+	for _, i := range rand.Perm(len(c.entries)) {
+		entry := c.entries[i]
+		if score := ucb1(entry.picks, entry.finds, total); score > bestScore {
+			best, bestScore = entry, score
+		}
+	}
+	return best
+}
+
+// bodies returns the request bodies of all corpus entries.
+func (c *corpus) bodies() []interface{} {
+	var bodies []interface{}
+	for _, entry := range c.entries {
+		for _, input := range entry.Inputs {
+			if input.Body != nil {
+				bodies = append(bodies, input.Body)
+			}
+		}
+	}
+	return bodies
+}
+
+func newFuzzer(graph *dependencyGraph, c *corpus, sequenceLength int) *fuzzer {
+	return &fuzzer{graph: graph, corpus: c, sequenceLength: sequenceLength, seen: make(map[string]bool), hits: make(hitMap), hitCounts: true, coverage: true, acceptedGarbage: make(map[string]bool), scheduler: newOperatorScheduler(operatorNames()), operations: newOperationBandit(graph.endpoints), oracle: &oracle{seen: make(map[string]bool)}}
+}
+
+// markSeen records blocks as covered and returns their IDs.
+func (f *fuzzer) markSeen(blocks []coverageBlock) []string {
+	ids := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if !f.seen[block.ID] {
+			f.seen[block.ID] = true
+			ids = append(ids, block.ID)
+		}
+	}
+	return ids
+}
+
+// step runs one iteration of the loop and reports whether it covered blocks
+// that were not covered before.
+func (f *fuzzer) step() (bool, error) {
+	parent, inputs, applied := f.next()
+	if len(inputs) == 0 {
+		return false, nil
+	}
+
+	f.iterations++
+	sent, exchanges := f.graph.runInputs(inputs)
+	statusCodes := statusCodes(exchanges)
+	reported := f.reportAcceptedGarbage(sent, statusCodes)
+	failed, down := f.oracle.check(sent, exchanges)
+	reported = append(reported, failed...)
+	f.findings += len(reported)
+
+	var found []string
+	newHits := 0
+	// a target that went down has no coverage to ask for; when asking
+	// fails, the statuses and findings of the sequence still count
+	var coverageErr error
+	if down == nil && f.coverage {
+		var blocks []coverageBlock
+		var cursor string
+		if blocks, cursor, coverageErr = fetchNewBlocks(f.cursor); coverageErr == nil {
+			f.cursor = cursor
+			found = f.markSeen(blocks)
+			if f.hitCounts {
+				newHits = f.recordReached(sent)
+			} else if len(found) > 0 {
+				f.recordReached(sent)
+			}
+		}
+	}
+	newStatuses := f.rewardOperations(sent, statusCodes, found, reported)
+	f.scheduler.credit(applied, len(found), newHits, len(reported))
+	if parent != nil && (len(found) > 0 || newHits > 0 || newStatuses > 0 || len(reported) > 0) {
+		parent.finds++
+	}
+	if down != nil {
+		return false, down
+	}
+	if coverageErr != nil {
+		return false, coverageErr
+	}
+	fmt.Printf("Covered blocks: %d, hit buckets: %d, corpus: %d\n", len(f.seen), f.hits.size(), len(f.corpus.entries))
+	if len(found) == 0 && newHits == 0 {
+		return false, nil
+	}
+	fmt.Printf("%d new blocks, %d new hit counts from %s\n", len(found), newHits, describeSequence(sent))
+	entry := &corpusEntry{Inputs: sent, Blocks: found, Hits: newHits}
+	if parent != nil {
+		entry.Depth = parent.Depth + 1
+	}
+	return true, f.corpus.add(entry)
+}
+
+// next returns the sequence to run: a fresh one built from the operations
+// the bandit favours, or the next mutant of the corpus entry being fuzzed,
+// which is returned as well, with the operators that made the mutant. An
+// entry is fuzzed for as many mutants as its energy before the next one is
+// picked.
+func (f *fuzzer) next() (*corpusEntry, []requestInput, []int) {
+	if len(f.corpus.entries) == 0 || rand.Float64() < exploreChance {
+		var inputs []requestInput
+		for _, op := range f.graph.generateSequence(f.sequenceLength, f.operations.choose) {
+			input := generateInput(f.graph.endpoints[op], nil)
+			input.Op = op
+			inputs = append(inputs, input)
+		}
+		return nil, inputs, nil
+	}
+	if f.current == nil || f.energy == 0 {
+		f.current = f.corpus.pick()
+		f.energy = f.current.energy(f.corpus.averages())
+	}
+	f.energy--
+	f.current.picks++
+	inputs, applied := f.mutateSequence(f.current.Inputs)
+	return f.current, inputs, applied
+}
+
+// reportAcceptedGarbage prints each operation that answered a malformed
+// body with success, once per kind of malformation: such handlers decode
+// without checking the error and carry on with whatever they got. It
+// returns the steps it printed.
+func (f *fuzzer) reportAcceptedGarbage(sent []requestInput, statusCodes []int) []int {
+	var reported []int
+	for i, input := range sent {
+		if input.Malformed == "" || statusCodes[i] < 200 || statusCodes[i] >= 300 {
+			continue
+		}
+		key := input.Operation + " " + input.Malformed
+		if f.acceptedGarbage[key] {
+			continue
+		}
+		f.acceptedGarbage[key] = true
+		fmt.Printf("%s accepted a malformed body (%s) with status %d: %q\n", input.Operation, input.Malformed, statusCodes[i], truncateForLog(input.RawBody))
+		reported = append(reported, i)
+	}
+	return reported
+}
+
+// truncateForLog shortens payloads such as deeply nested arrays for
+// printing.
+func truncateForLog(data []byte) string {
+	if len(data) > 80 {
+		return string(data[:80]) + "..."
+	}
+	return string(data)
+}
+
+// recordReached stores the blocks each step of a sequence covered, as far as
+// the target attributed them, and returns how many blocks a step ran a
+// number of times that falls into a new hit-count bucket. Targets without
+// per-request attribution leave Reached empty.
+func (f *fuzzer) recordReached(inputs []requestInput) int {
+	newHits := 0
+	for i := range inputs {
+		blocks, err := fetchRequestBlocks(inputs[i].RequestID)
+		if err != nil {
+			return newHits
+		}
+		inputs[i].Reached = make([]string, len(blocks))
+		for j, block := range blocks {
+			inputs[i].Reached[j] = block.ID
+		}
+		newHits += f.hits.add(blocks)
+	}
+	return newHits
+}
+
+// mutateSequence returns a copy of inputs with one to maxMutations mutations
+// applied, and the indexes of the operators that made them. Steps whose path
+// dependencies are no longer produced by an earlier step are kept; their
+// values then come from the harvested pool.
+func (f *fuzzer) mutateSequence(inputs []requestInput) ([]requestInput, []int) {
+	mutated := make([]requestInput, len(inputs))
+	for i, input := range inputs {
+		mutated[i] = input.clone()
+	}
+	var applied []int
+	for n := 1 + rand.Intn(maxMutations); n > 0; n-- {
+		var op int
+		mutated, op = f.mutateOnce(mutated)
+		if op >= 0 {
+			applied = append(applied, op)
+		}
+	}
+	if rand.Float64() < malformedChance {
+		var withBody []int
+		for i, input := range mutated {
+			if f.graph.endpoints[input.Op].RequestBody != nil {
+				withBody = append(withBody, i)
+			}
+		}
+		if len(withBody) > 0 {
+			input := &mutated[withBody[rand.Intn(len(withBody))]]
+			malformBody(input)
+			applied = append(applied, f.scheduler.index("malformed:"+input.Malformed))
+		}
+	}
+	return mutated, applied
+}
+
+// maxOperatorAttempts bounds how often mutateOnce asks the scheduler for
+// another operator when the chosen one finds nothing to work on, e.g. a
+// body mutation on a sequence without bodies.
+const maxOperatorAttempts = 8
+
+// mutateOnce applies one operator chosen by the scheduler and returns its
+// index, -1 if none could be applied.
+func (f *fuzzer) mutateOnce(inputs []requestInput) ([]requestInput, int) {
+	if len(inputs) == 0 {
+		mutated, ok := mutationOperators[insertStepOperator].apply(f, inputs)
+		if !ok {
+			return inputs, -1
+		}
+		return mutated, insertStepOperator
+	}
+	for attempt := 0; attempt < maxOperatorAttempts; attempt++ {
+		op := f.scheduler.pick()
+		if mutated, ok := mutationOperators[op].apply(f, inputs); ok {
+			return mutated, op
+		}
+	}
+	// the scheduler keeps picking operators that do not apply here, so
+	// take any that does
+	for _, op := range rand.Perm(len(mutationOperators)) {
+		if mutated, ok := mutationOperators[op].apply(f, inputs); ok {
+			return mutated, op
+		}
+	}
+	return inputs, -1
+}
+
+// mutationOperator is one way of changing a sequence. apply may change the
+// steps of inputs in place; ok is false when the sequence has nothing the
+// operator can work on, in which case inputs is left as it was.
+type mutationOperator struct {
+	name  string
+	apply func(f *fuzzer, inputs []requestInput) (mutated []requestInput, ok bool)
+}
+
+// insertStepOperator is the index of insert-step, the only operator that
+// works on an empty sequence.
+var insertStepOperator = mutationOperatorIndex("insert-step")
+
+// mutationOperatorIndex returns the index of the named operator in
+// mutationOperators and panics if there is none.
+func mutationOperatorIndex(name string) int {
+	for i, op := range mutationOperators {
+		if op.name == name {
+			return i
+		}
+	}
+	panic("unknown mutation operator " + name)
+}
+
+var mutationOperators = append([]mutationOperator{
+	{"regenerate-param", (*fuzzer).regenerateParam},
+	{"toggle-optional-param", (*fuzzer).toggleOptionalParam},
+	{"regenerate-body-field", (*fuzzer).regenerateBodyField},
+	{"insert-step", func(f *fuzzer, inputs []requestInput) ([]requestInput, bool) {
+		mutated := f.insertStep(inputs, rand.Intn(len(inputs)+1))
+		return mutated, len(mutated) > len(inputs)
+	}},
+	{"delete-step", func(f *fuzzer, inputs []requestInput) ([]requestInput, bool) {
+		if len(inputs) < 2 {
+			return inputs, false
+		}
+		step := rand.Intn(len(inputs))
+		return append(inputs[:step], inputs[step+1:]...), true
+	}},
+	{"repeat-step", func(f *fuzzer, inputs []requestInput) ([]requestInput, bool) {
+		// e.g. a second DELETE of the same resource
+		if len(inputs) == 0 {
+			return inputs, false
+		}
+		step := rand.Intn(len(inputs))
+		repeated := append([]requestInput{}, inputs[:step+1]...)
+		repeated = append(repeated, inputs[step].clone())
+		return append(repeated, inputs[step+1:]...), true
+	}},
+	{"swap-steps", func(f *fuzzer, inputs []requestInput) ([]requestInput, bool) {
+		// e.g. read a resource before it is created or after it is
+		// deleted
+		if len(inputs) < 2 {
+			return inputs, false
+		}
+		step := rand.Intn(len(inputs) - 1)
+		inputs[step], inputs[step+1] = inputs[step+1], inputs[step]
+		return inputs, true
+	}},
+}, bodyOperators()...)
+
+// bodyOperators wraps each structural JSON operator as an operator on a
+// random step with a body, so the scheduler weighs them one by one.
+func bodyOperators() []mutationOperator {
+	ops := make([]mutationOperator, len(jsonOperators))
+	for i, op := range jsonOperators {
+		op := op
+		ops[i] = mutationOperator{"body:" + op.name, func(f *fuzzer, inputs []requestInput) ([]requestInput, bool) {
+			return f.mutateBody(inputs, op)
+		}}
+	}
+	return ops
+}
+
+// operatorNames lists the scheduled operators and, after them, the
+// malformed-body kinds, which are counted but not scheduled.
+func operatorNames() (scheduled, counted []string) {
+	for _, op := range mutationOperators {
+		scheduled = append(scheduled, op.name)
+	}
+	for _, kind := range malformedKinds {
+		counted = append(counted, "malformed:"+kind.name)
+	}
+	return scheduled, counted
+}
+
+// regenerateParam regenerates one parameter of a step and keeps it even if
+// an earlier response would supply it.
+func (f *fuzzer) regenerateParam(inputs []requestInput) ([]requestInput, bool) {
+	if len(inputs) == 0 {
+		return inputs, false
+	}
+	input := &inputs[rand.Intn(len(inputs))]
+	endpoint := f.graph.endpoints[input.Op]
+	if len(endpoint.Parameters) == 0 {
+		return inputs, false
+	}
+	param := endpoint.Parameters[rand.Intn(len(endpoint.Parameters))]
+	if param.In == "body" {
+		return inputs, false
+	}
+	input.Params[param.Name] = generateParamValue(param, endpoint.Path)
+	if !input.pinned(param.Name) {
+		input.Pinned = append(input.Pinned, param.Name)
+	}
+	return inputs, true
+}
+
+// toggleOptionalParam drops an optional parameter of a step, or puts it
+// back.
+func (f *fuzzer) toggleOptionalParam(inputs []requestInput) ([]requestInput, bool) {
+	if len(inputs) == 0 {
+		return inputs, false
+	}
+	input := &inputs[rand.Intn(len(inputs))]
+	endpoint := f.graph.endpoints[input.Op]
+	var optional []ParameterInfo
+	for _, param := range endpoint.Parameters {
+		if !param.Required && param.In != "body" {
+			optional = append(optional, param)
+		}
+	}
+	if len(optional) == 0 {
+		return inputs, false
+	}
+	param := optional[rand.Intn(len(optional))]
+	if _, ok := input.Params[param.Name]; ok {
+		delete(input.Params, param.Name)
+	} else {
+		input.Params[param.Name] = generateParamValue(param, endpoint.Path)
+	}
+	return inputs, true
+}
+
+// regenerateBodyField regenerates one property of the body of a step, or
+// the whole body.
+func (f *fuzzer) regenerateBodyField(inputs []requestInput) ([]requestInput, bool) {
+	var withBody []int
+	for i, input := range inputs {
+		if f.graph.endpoints[input.Op].RequestBody != nil {
+			withBody = append(withBody, i)
+		}
+	}
+	if len(withBody) == 0 {
+		return inputs, false
+	}
+	input := &inputs[withBody[rand.Intn(len(withBody))]]
+	endpoint := f.graph.endpoints[input.Op]
+	input.RawBody, input.ContentType, input.Malformed = nil, "", ""
+	body, ok := input.Body.(map[string]interface{})
+	props, _ := endpoint.RequestBody["properties"].(map[string]interface{})
+	if !ok || len(props) == 0 {
+		input.Body = generateBody(endpoint, nil)
+		return inputs, true
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	name := names[rand.Intn(len(names))]
+	prop, _ := props[name].(map[string]interface{})
+	body = copyObject(body)
+	body[name] = generateFieldValue(name, prop)
+	input.Body = body
+	if !input.pinned(name) {
+		input.Pinned = append(input.Pinned, name)
+	}
+	return inputs, true
+}
+
+// mutateBody changes the structure of the body of a step with op, keeping
+// the schema in mind but not to it.
+func (f *fuzzer) mutateBody(inputs []requestInput, op jsonOperator) ([]requestInput, bool) {
+	var withBody []int
+	for i, input := range inputs {
+		if input.Body != nil {
+			withBody = append(withBody, i)
+		}
+	}
+	if len(withBody) == 0 {
+		return inputs, false
+	}
+	input := &inputs[withBody[rand.Intn(len(withBody))]]
+	m := &jsonMutator{schema: f.graph.endpoints[input.Op].RequestBody, donors: f.corpus.bodies()}
+	body, field, ok := m.apply(op, input.Body)
+	if !ok {
+		return inputs, false
+	}
+	input.Body = body
+	input.RawBody, input.ContentType, input.Malformed = nil, "", ""
+	if field != "" && !input.pinned(field) {
+		input.Pinned = append(input.Pinned, field)
+	}
+	return inputs, true
+}
+
+// insertStep inserts a freshly generated step at pos. The operation bandit
+// chooses among the operations whose path dependencies are produced by the
+// steps before it.
+func (f *fuzzer) insertStep(inputs []requestInput, pos int) []requestInput {
+	prefix := make([]int, pos)
+	for i := range prefix {
+		prefix[i] = inputs[i].Op
+	}
+	var candidates []int
+	for op := range f.graph.endpoints {
+		if f.graph.satisfied(op, prefix) {
+			candidates = append(candidates, op)
+		}
+	}
+	if len(candidates) == 0 {
+		return inputs
+	}
+	op := f.operations.choose(candidates, prefix)
+	input := generateInput(f.graph.endpoints[op], nil)
+	input.Op = op
+
+	inserted := append([]requestInput{}, inputs[:pos]...)
+	inserted = append(inserted, input)
+	return append(inserted, inputs[pos:]...)
+}
+
+// describeSequence renders a sequence as "POST /user → GET /user/{id}".
+func describeSequence(inputs []requestInput) string {
+	names := make([]string, len(inputs))
+	for i, input := range inputs {
+		names[i] = input.Operation
+	}
+	return strings.Join(names, " → ")
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCorpusPickPrefersProductiveEntries(t *testing.T) {
+	productive := &corpusEntry{finds: 5, picks: 5}
+	stale := &corpusEntry{picks: 50}
+	c := &corpus{entries: []*corpusEntry{stale, productive}}
+
+	counts := make(map[*corpusEntry]int)
+	for i := 0; i < 1000; i++ {
+		counts[c.pick()]++
+	}
+	if counts[productive] <= counts[stale]*10 {
+		t.Errorf("stale entry not deprioritized: productive %d, stale %d", counts[productive], counts[stale])
+	}
+}
+
+func TestCorpusSaveAndLoad(t *testing.T) {
+	g := sampleGraph(t)
+	dir := t.TempDir()
+	c, err := loadCorpus(dir, g.endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := generateInput(g.endpoints[0], nil)
+	if err := c.add(&corpusEntry{Inputs: []requestInput{input}, Blocks: []string{"00000000000000ff"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCorpus(dir, g.endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.entries) != 1 || len(loaded.entries[0].Blocks) != 1 {
+		t.Fatalf("corpus not restored: %+v", loaded.entries)
+	}
+	if got := loaded.entries[0].Inputs[0]; got.Op != 0 || got.Operation != operationName(g.endpoints[0]) {
+		t.Errorf("operation not resolved on load: %+v", got)
+	}
+}
+
+func TestCorpusAddAfterDroppedEntries(t *testing.T) {
+	g := sampleGraph(t)
+	dir := t.TempDir()
+	c, err := loadCorpus(dir, g.endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.add(&corpusEntry{Inputs: []requestInput{generateInput(g.endpoints[0], nil)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first entry's operation is gone from the spec
+	stale := &corpusEntry{Inputs: []requestInput{{Operation: "GET /removed", Params: map[string]interface{}{}}}}
+	if err := writeJSONFile(stale, filepath.Join(dir, "000001.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := loadCorpus(dir, g.endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed.entries) != 1 {
+		t.Fatalf("want 1 entry after dropping the stale one, got %d", len(resumed.entries))
+	}
+	if err := resumed.add(&corpusEntry{Inputs: []requestInput{generateInput(g.endpoints[1], nil)}}); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 3 || filepath.Base(files[2]) != "000003.json" {
+		t.Errorf("existing corpus file overwritten: %v", files)
+	}
+}
+
+func TestFuzzerKeepsCoverageIncreasingSequences(t *testing.T) {
+	logged := []coverageBlock{{ID: "a", Count: 1}}
+	reached := make(map[string][]coverageBlock)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/coverage/blocks" {
+			// the cursor counts the blocks logged before
+			since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"blocks": logged[since:], "cursor": strconv.Itoa(len(logged))})
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/coverage/requests/") {
+			id := strings.TrimPrefix(r.URL.Path, "/coverage/requests/")
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "blocks": reached[id]})
+			return
+		}
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			t.Errorf("%s %s sent without a request ID", r.Method, r.URL.Path)
+		}
+		// only a DELETE reaches block d
+		if r.Method == "DELETE" {
+			if len(logged) == 1 {
+				logged = append(logged, coverageBlock{ID: "d", Count: 1})
+			}
+			reached[id] = []coverageBlock{logged[1]}
+		}
+		w.Write([]byte(`{"id": 1, "username": "ash"}`))
+	}))
+	defer server.Close()
+	defer func(old string) { baseURL = old }(baseURL)
+	baseURL = server.URL
+
+	f := newFuzzer(sampleGraph(t), &corpus{}, 3)
+	f.seen["a"] = true
+	for i := 0; i < 50; i++ {
+		if _, err := f.step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(f.corpus.entries) != 1 {
+		t.Fatalf("want exactly the first sequence with a DELETE in the corpus, got %d entries", len(f.corpus.entries))
+	}
+	entry := f.corpus.entries[0]
+	if seq := describeSequence(entry.Inputs); !strings.Contains(seq, "DELETE") || len(entry.Blocks) != 1 || entry.Blocks[0] != "d" {
+		t.Errorf("corpus entry does not contain the DELETE: %s", seq)
+	}
+	for _, input := range entry.Inputs {
+		if strings.HasPrefix(input.Operation, "DELETE") != (len(input.Reached) == 1) {
+			t.Errorf("wrong blocks recorded for %s: %v", input.Operation, input.Reached)
+		}
+	}
+}
+
+func TestStepCreditsFindingsWithoutCoverage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/coverage/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	defer func(old string) { baseURL = old }(baseURL)
+	baseURL = server.URL
+
+	f := newFuzzer(sampleGraph(t), &corpus{}, 3)
+	if _, err := f.step(); err == nil {
+		t.Fatal("coverage error not returned")
+	}
+	rewards := 0
+	for _, arm := range f.operations.arms {
+		rewards += arm.Rewards
+	}
+	if f.findings == 0 || rewards == 0 {
+		t.Errorf("findings of the sequence not credited: %d findings, %d rewards", f.findings, rewards)
+	}
+}
+
+func TestMutateSequenceKeepsPinnedValues(t *testing.T) {
+	g := sampleGraph(t)
+	f := newFuzzer(g, &corpus{}, 3)
+	var post, get int
+	for i, endpoint := range g.endpoints {
+		switch operationName(endpoint) {
+		case "POST /user":
+			post = i
+		case "GET /user/{id}":
+			get = i
+		}
+	}
+	seq := []requestInput{generateInput(g.endpoints[post], nil), generateInput(g.endpoints[get], nil)}
+	seq[0].Op, seq[1].Op = post, get
+	seq[1].Params["id"] = "pinned"
+	seq[1].Pinned = []string{"id"}
+
+	for i := 0; i < 100; i++ {
+		mutated, _ := f.mutateSequence(seq)
+		if len(mutated) == 0 {
+			t.Fatal("mutation produced an empty sequence")
+		}
+		for _, input := range mutated {
+			if input.Operation != operationName(g.endpoints[input.Op]) {
+				t.Fatalf("mutated step has mismatched operation: %+v", input)
+			}
+		}
+	}
+	if seq[1].Params["id"] != "pinned" || len(seq) != 2 {
+		t.Error("mutateSequence modified its input")
+	}
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 4711, "username": "ash"}`))
+	}))
+	defer server.Close()
+	defer func(old string) { baseURL = old }(baseURL)
+	baseURL = server.URL
+
+	g.runInputs(seq)
+	if len(paths) != 2 || paths[1] != "GET /user/pinned" {
+		t.Errorf("pinned id was overwritten by the produced one: %v", paths)
+	}
+}
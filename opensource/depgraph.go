@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxResponseFieldDepth bounds how deep response schemas are searched for
+// fields that can feed other operations.
+const maxResponseFieldDepth = 3
+
+// dependency records that a field of one operation's response can supply a
+// parameter of another operation, e.g. User.id from POST /user feeds the id
+// path parameter of GET /user/{id}.
+type dependency struct {
+	Producer int
+	// Field is the path to the value in the response; "[]" steps into an
+	// array element, e.g. [] id for the ids in a list response.
+	Field    []string
+	Consumer int
+	Param    string
+	In       string
+}
+
+// dependencyGraph holds the inferred producer-consumer relations between the
+// operations of an API, RESTler-style.
+type dependencyGraph struct {
+	endpoints []EndpointInfo
+	edges     []dependency
+	// runs counts how often each operation was put in a sequence, so that
+	// rarely exercised operations are preferred.
+	runs []int
+}
+
+// responseField is a named value found in a response schema.
+type responseField struct {
+	path []string
+	name string
+}
+
+// inferDependencies matches every operation's response fields against the
+// path, query, header, cookie, formData and top-level body parameters of the
+// other operations by normalized name. A response "id" counts as
+// <resource>Id, and feeds a bare "id" parameter of operations on the same
+// resource.
+func inferDependencies(endpoints []EndpointInfo) *dependencyGraph {
+	g := &dependencyGraph{endpoints: endpoints, runs: make([]int, len(endpoints))}
+	for producer, p := range endpoints {
+		fields := responseFields(successSchema(p), nil, 0)
+		resource := resourceName(p.Path)
+		for consumer, c := range endpoints {
+			if consumer == producer {
+				continue
+			}
+			for _, param := range consumerParams(c) {
+				for _, field := range fields {
+					if fieldFeedsParam(field, resource, param, c.Path) {
+						g.edges = append(g.edges, dependency{
+							Producer: producer,
+							Field:    field.path,
+							Consumer: consumer,
+							Param:    param.Name,
+							In:       param.In,
+						})
+						break
+					}
+				}
+			}
+		}
+	}
+	return g
+}
+
+// successSchema returns the schema of the first documented 2xx response.
+func successSchema(endpoint EndpointInfo) map[string]interface{} {
+	codes := make([]string, 0, len(endpoint.Responses))
+	for code := range endpoint.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	sort.Strings(codes)
+	return endpoint.Responses[codes[0]]
+}
+
+// responseFields lists the scalar fields of a response schema.
+func responseFields(schema map[string]interface{}, path []string, depth int) []responseField {
+	if schema == nil || depth > maxResponseFieldDepth {
+		return nil
+	}
+	var fields []responseField
+	switch schemaType(schema) {
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		return responseFields(items, append(append([]string{}, path...), "[]"), depth+1)
+	case "object", "":
+		props, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, _ := props[name].(map[string]interface{})
+			fieldPath := append(append([]string{}, path...), name)
+			switch schemaType(prop) {
+			case "object", "array":
+				fields = append(fields, responseFields(prop, fieldPath, depth+1)...)
+			default:
+				fields = append(fields, responseField{path: fieldPath, name: name})
+			}
+		}
+	}
+	return fields
+}
+
+// consumerParams lists the parameters of an operation that can take a
+// produced value, including the top-level properties of its JSON body.
+func consumerParams(endpoint EndpointInfo) []ParameterInfo {
+	var params []ParameterInfo
+	for _, param := range endpoint.Parameters {
+		if param.In != "body" {
+			params = append(params, param)
+		}
+	}
+	if props, ok := endpoint.RequestBody["properties"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			params = append(params, ParameterInfo{Name: name, In: "body"})
+		}
+	}
+	return params
+}
+
+// fieldFeedsParam decides whether a response field of an operation on
+// resource can supply param of an operation on consumerPath. Only
+// identifier-like names are linked, otherwise every "name" field would
+// depend on every other.
+func fieldFeedsParam(field responseField, resource string, param ParameterInfo, consumerPath string) bool {
+	fieldName, paramName := normalizeName(field.name), normalizeName(param.Name)
+	if !isIdentifierName(paramName) && param.In != "path" {
+		return false
+	}
+	if fieldName == paramName && (fieldName != "id" || resourceName(consumerPath) == resource) {
+		return true
+	}
+	// a top-level id of a user response is the userId elsewhere
+	if fieldName == "id" && resource != "" && paramName == normalizeName(resource+"Id") {
+		return true
+	}
+	return false
+}
+
+// isIdentifierName reports whether a normalized name looks like it refers to
+// a resource: id, userid, uuid, key, slug, name of a path segment and so on.
+func isIdentifierName(name string) bool {
+	for _, suffix := range []string{"id", "uuid", "key", "slug", "code", "token", "ref"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependenciesOf returns the edges that end in consumer.
+func (g *dependencyGraph) dependenciesOf(consumer int) []dependency {
+	var deps []dependency
+	for _, edge := range g.edges {
+		if edge.Consumer == consumer {
+			deps = append(deps, edge)
+		}
+	}
+	return deps
+}
+
+// satisfied reports whether every path parameter of consumer that has a
+// known producer is produced by an operation already in seq.
+func (g *dependencyGraph) satisfied(consumer int, seq []int) bool {
+	needed := make(map[string]bool)
+	met := make(map[string]bool)
+	for _, edge := range g.dependenciesOf(consumer) {
+		if edge.In != "path" {
+			continue
+		}
+		needed[edge.Param] = true
+		for _, op := range seq {
+			if op == edge.Producer {
+				met[edge.Param] = true
+			}
+		}
+	}
+	return len(met) == len(needed)
+}
+
+// generateSequence builds a request sequence of the given length. Each step
+// is an operation whose path dependencies are produced by an earlier step;
+// choose picks among those, given the sequence so far. With a nil choose,
+// operations that have been run least so far are preferred, and operations
+// already in the sequence are less likely to be picked again.
+func (g *dependencyGraph) generateSequence(length int, choose func(candidates, seq []int) int) []int {
+	if choose == nil {
+		choose = g.leastRun
+	}
+	var seq []int
+	for len(seq) < length {
+		var candidates []int
+		for op := range g.endpoints {
+			if g.satisfied(op, seq) {
+				candidates = append(candidates, op)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		picked := choose(candidates, seq)
+		seq = append(seq, picked)
+		g.runs[picked]++
+	}
+	return seq
+}
+
+// leastRun picks one of candidates with a probability that falls with the
+// number of times it was run and is in seq.
+func (g *dependencyGraph) leastRun(candidates, seq []int) int {
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, op := range candidates {
+		weight := 1 / float64(1+g.runs[op])
+		for _, prior := range seq {
+			if prior == op {
+				weight /= 4
+			}
+		}
+		weights[i] = weight
+		total += weight
+	}
+	choice := rand.Float64() * total
+	for i, weight := range weights {
+		if choice < weight {
+			return candidates[i]
+		}
+		choice -= weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// runSequence generates an input for every operation of seq and runs them
+// with runInputs. It returns the status code of every step.
+func (g *dependencyGraph) runSequence(seq []int) []int {
+	inputs := make([]requestInput, len(seq))
+	for step, op := range seq {
+		inputs[step] = generateInput(g.endpoints[op], nil)
+		inputs[step].Op = op
+	}
+	_, exchanges := g.runInputs(inputs)
+	return statusCodes(exchanges)
+}
+
+// runInputs sends inputs in order, feeding values from each response into
+// the parameters of later steps that depend on it, except for parameters a
+// step has pinned. It returns the inputs as they were actually sent and the
+// exchange of every step. A sequence ends early when the target refuses a
+// connection, as it will refuse the remaining steps as well.
+func (g *dependencyGraph) runInputs(inputs []requestInput) ([]requestInput, []exchange) {
+	sent := make([]requestInput, 0, len(inputs))
+	exchanges := make([]exchange, 0, len(inputs))
+	fixed := make(map[int]map[string]interface{})
+	for _, input := range inputs {
+		endpoint := g.endpoints[input.Op]
+		input = input.clone()
+		for name, value := range fixed[input.Op] {
+			if input.pinned(name) {
+				continue
+			}
+			if body, ok := input.Body.(map[string]interface{}); ok && endpoint.RequestBody != nil {
+				input.Body = fixBodyFields(endpoint.RequestBody, copyObject(body), map[string]interface{}{name: value})
+			}
+			if hasParam(endpoint, name) || strings.Contains(endpoint.Path, "{"+name+"}") {
+				input.Params[name] = value
+			}
+		}
+		input.RequestID = uuid.NewString()
+		sent = append(sent, input)
+
+		e, response := triggerAPI(endpoint, input)
+		exchanges = append(exchanges, e)
+		statusCode := e.statusCode()
+		fmt.Printf("%s %s Status Code: %d\n", strings.ToUpper(endpoint.Method), endpoint.Path, statusCode)
+		if e.Failure == failureRefused {
+			break
+		}
+		if statusCode < 200 || statusCode >= 300 || response == nil {
+			continue
+		}
+		for _, edge := range g.edges {
+			if edge.Producer != input.Op {
+				continue
+			}
+			if value, ok := extractField(response, edge.Field); ok {
+				if fixed[edge.Consumer] == nil {
+					fixed[edge.Consumer] = make(map[string]interface{})
+				}
+				fixed[edge.Consumer][edge.Param] = value
+			}
+		}
+	}
+	return sent, exchanges
+}
+
+// hasParam reports whether endpoint declares a non-body parameter name.
+func hasParam(endpoint EndpointInfo, name string) bool {
+	for _, param := range endpoint.Parameters {
+		if param.Name == name && param.In != "body" {
+			return true
+		}
+	}
+	return false
+}
+
+func copyObject(object map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		copied[key] = value
+	}
+	return copied
+}
+
+// extractField follows a field path through a decoded response, picking a
+// random element wherever the path steps into an array.
+func extractField(value interface{}, path []string) (interface{}, bool) {
+	for _, step := range path {
+		if step == "[]" {
+			items, ok := value.([]interface{})
+			if !ok || len(items) == 0 {
+				return nil, false
+			}
+			value = items[rand.Intn(len(items))]
+			continue
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[step]; !ok {
+			return nil, false
+		}
+	}
+	switch value.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return nil, false
+	}
+	return value, true
+}
+
+// operationName labels an operation as "GET /user/{id}".
+func operationName(endpoint EndpointInfo) string {
+	return strings.ToUpper(endpoint.Method) + " " + endpoint.Path
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Every operation is a
+// node; every edge is labelled with the response field and the parameter it
+// feeds.
+func (g *dependencyGraph) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph api {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, endpoint := range g.endpoints {
+		fmt.Fprintf(&sb, "\t%q;\n", operationName(endpoint))
+	}
+	for _, edge := range g.edges {
+		label := fmt.Sprintf("%s → %s (%s)", strings.Join(edge.Field, "."), edge.Param, edge.In)
+		fmt.Fprintf(&sb, "\t%q -> %q [label=%q];\n",
+			operationName(g.endpoints[edge.Producer]), operationName(g.endpoints[edge.Consumer]), label)
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
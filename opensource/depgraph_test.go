@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func sampleGraph(t *testing.T) *dependencyGraph {
+	data, err := os.ReadFile("swagger.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := ParseAPIDefinition(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortEndpoints(endpoints)
+	return inferDependencies(endpoints)
+}
+
+func TestInferDependencies(t *testing.T) {
+	g := sampleGraph(t)
+
+	var dot strings.Builder
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"POST /user" -> "GET /user/{id}" [label="id → id (path)"]`,
+		`"POST /user" -> "DELETE /user/{id}" [label="id → id (path)"]`,
+		`"GET /users" -> "PUT /user/{id}" [label="[].id → id (path)"]`,
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("missing edge %s in\n%s", want, dot.String())
+		}
+	}
+}
+
+func TestGenerateSequenceRespectsDependencies(t *testing.T) {
+	g := sampleGraph(t)
+	for i := 0; i < 100; i++ {
+		seq := g.generateSequence(5, nil)
+		if len(seq) != 5 {
+			t.Fatalf("wrong sequence length: got %d want %d", len(seq), 5)
+		}
+		for step, op := range seq {
+			if !g.satisfied(op, seq[:step]) {
+				t.Fatalf("%s scheduled before its producer in %v", operationName(g.endpoints[op]), seq)
+			}
+		}
+	}
+}
+
+func TestRunSequenceThreadsValues(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 4711, "username": "ash"}`))
+	}))
+	defer server.Close()
+	defer func(old string) { baseURL = old }(baseURL)
+	baseURL = server.URL
+
+	g := sampleGraph(t)
+	var post, get int
+	for i, endpoint := range g.endpoints {
+		switch operationName(endpoint) {
+		case "POST /user":
+			post = i
+		case "GET /user/{id}":
+			get = i
+		}
+	}
+	g.runSequence([]int{post, get})
+	if len(paths) != 2 || paths[1] != "GET /user/4711" {
+		t.Errorf("id was not threaded from POST to GET: %v", paths)
+	}
+}
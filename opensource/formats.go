@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// malformedFormatChance is how often a value with a known format is replaced
+// by a deliberately malformed variant.
+const malformedFormatChance = 0.1
+
+// FormatGenerator produces values for a schema format such as date-time or
+// email. Valid values must be accepted by a conforming server; Malformed
+// values look plausible but break the format, so the target's parsing and
+// rejection paths get exercised. Either function may be nil.
+type FormatGenerator struct {
+	Valid     func(schema map[string]interface{}) interface{}
+	Malformed func(schema map[string]interface{}) interface{}
+}
+
+var formatGenerators = map[string]FormatGenerator{
+	"date": {
+		Valid:     func(map[string]interface{}) interface{} { return randomTime().Format("2006-01-02") },
+		Malformed: pickString("2023-02-30", "2023-13-01", "23-01-01", "2023/01/01", "2023-1-1", "0000-00-00"),
+	},
+	"date-time": {
+		Valid: func(map[string]interface{}) interface{} {
+			layouts := []string{time.RFC3339, time.RFC3339Nano, "2006-01-02T15:04:05-07:00"}
+			t := randomTime()
+			if rand.Intn(2) == 0 {
+				t = t.In(time.FixedZone("", (rand.Intn(27)-12)*3600))
+			}
+			return t.Format(layouts[rand.Intn(len(layouts))])
+		},
+		Malformed: pickString("2023-01-01T10:00:00", "2023-01-01 10:00:00Z", "2023-01-01T25:00:00Z", "2023-02-29T10:00:00Z", "2023-01-01T10:00:00+25:00", "1672567200"),
+	},
+	"time": {
+		Valid:     func(map[string]interface{}) interface{} { return randomTime().Format("15:04:05Z07:00") },
+		Malformed: pickString("24:00:00Z", "10:60:00Z", "10:00", "10:00:00+"),
+	},
+	"email": {
+		Valid: func(map[string]interface{}) interface{} {
+			return randomLabel() + "@" + randomHostname()
+		},
+		Malformed: pickString("user@", "@example.com", "user@@example.com", "user example@example.com", "user@example..com", "user@-example.com", "user"),
+	},
+	"hostname": {
+		Valid:     func(map[string]interface{}) interface{} { return randomHostname() },
+		Malformed: pickString("-bad-.com", "a..b", "exa_mple.com", strings.Repeat("a", 64)+".com", "host name", ""),
+	},
+	"uri": {
+		Valid:     func(map[string]interface{}) interface{} { return randomURI() },
+		Malformed: pickString("http://[::1", "://missing-scheme", "http//example.com", "http://exa mple.com/", "http://example.com:99999/", "%zz"),
+	},
+	"ipv4": {
+		Valid: func(map[string]interface{}) interface{} {
+			return net.IPv4(byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256))).String()
+		},
+		Malformed: pickString("256.1.1.1", "1.2.3", "1.2.3.4.5", "01.02.03.004", "1.2.3.-4", "a.b.c.d"),
+	},
+	"ipv6": {
+		Valid: func(map[string]interface{}) interface{} {
+			ip := make(net.IP, net.IPv6len)
+			rand.Read(ip)
+			return ip.String()
+		},
+		Malformed: pickString("2001:db8::1::1", "2001:db8:::1", "12345::", "::ffff:256.1.1.1", "2001:db8:g::1", ":"),
+	},
+	"uuid": {
+		Valid:     func(map[string]interface{}) interface{} { return uuid.NewString() },
+		Malformed: pickString("123e4567-e89b-12d3-a456-42661417400Z", "123e4567e89b12d3a456426614174000a", "123e4567-e89b-12d3-a456", "{123e4567-e89b-12d3-a456-426614174000"),
+	},
+	"byte": {
+		Valid: func(map[string]interface{}) interface{} {
+			data := make([]byte, rand.Intn(48))
+			rand.Read(data)
+			return base64.StdEncoding.EncodeToString(data)
+		},
+		Malformed: pickString("not base64!", "YWJj=", "YW Jj", "====", "YWJjZA"),
+	},
+	"binary": {
+		Valid: func(map[string]interface{}) interface{} {
+			data := make([]byte, rand.Intn(64))
+			for i := range data {
+				data[i] = byte(0x20 + rand.Intn(0x5f))
+			}
+			return string(data)
+		},
+		Malformed: pickString("", "\x00\x01\x02\x03", strings.Repeat("\xff", 16)),
+	},
+	"int32":  integerFormat(math.MinInt32, math.MaxInt32),
+	"int64":  integerFormat(math.MinInt64, math.MaxInt64),
+	"float":  numberFormat(math.MaxFloat32, math.SmallestNonzeroFloat32),
+	"double": numberFormat(math.MaxFloat64, math.SmallestNonzeroFloat64),
+}
+
+func init() {
+	formatGenerators["url"] = formatGenerators["uri"]
+	formatGenerators["uri-reference"] = formatGenerators["uri"]
+	formatGenerators["idn-email"] = formatGenerators["email"]
+}
+
+// RegisterFormat adds or replaces the generator for a format name, so that
+// service-specific formats (e.g. "sku" or "e164") get meaningful values.
+func RegisterFormat(name string, generator FormatGenerator) {
+	formatGenerators[name] = generator
+}
+
+// generateFormat produces a value for a schema with a registered format. It
+// reports false if there is no generator for the format.
+func generateFormat(schema map[string]interface{}) (interface{}, bool) {
+	format, ok := schema["format"].(string)
+	if !ok {
+		return nil, false
+	}
+	generator, ok := formatGenerators[format]
+	if !ok {
+		return nil, false
+	}
+	if generator.Malformed != nil && (generator.Valid == nil || rand.Float64() < malformedFormatChance) {
+		return generator.Malformed(schema), true
+	}
+	if generator.Valid == nil {
+		return nil, false
+	}
+	return generator.Valid(schema), true
+}
+
+// integerFormat generates integers around the limits of a fixed-width
+// format. Bounded schemas keep to their bounds; unbounded ones get the
+// format's edges half of the time. Malformed values lie just outside the
+// format's range.
+func integerFormat(low, high int64) FormatGenerator {
+	return FormatGenerator{
+		Valid: func(schema map[string]interface{}) interface{} {
+			_, hasLow := schemaNumber(schema, "minimum")
+			_, hasHigh := schemaNumber(schema, "maximum")
+			if hasLow || hasHigh || rand.Intn(2) == 0 {
+				return generateInteger(schema)
+			}
+			edges := []int64{low, low + 1, -1, 0, 1, high - 1, high}
+			return edges[rand.Intn(len(edges))]
+		},
+		Malformed: func(map[string]interface{}) interface{} {
+			one := big.NewInt(1)
+			below := new(big.Int).Sub(big.NewInt(low), one)
+			above := new(big.Int).Add(big.NewInt(high), one)
+			values := []interface{}{json.Number(below.String()), json.Number(above.String()), 1.5, "12"}
+			return values[rand.Intn(len(values))]
+		},
+	}
+}
+
+// numberFormat generates floating point numbers at the limits of a format.
+func numberFormat(max, smallest float64) FormatGenerator {
+	return FormatGenerator{
+		Valid: func(schema map[string]interface{}) interface{} {
+			_, hasLow := schemaNumber(schema, "minimum")
+			_, hasHigh := schemaNumber(schema, "maximum")
+			if hasLow || hasHigh || rand.Intn(2) == 0 {
+				return generateNumber(schema)
+			}
+			edges := []float64{-max, -smallest, 0, smallest, max}
+			return edges[rand.Intn(len(edges))]
+		},
+		Malformed: func(map[string]interface{}) interface{} {
+			values := []interface{}{json.Number(fmt.Sprintf("%g", max*10)), json.Number("1e400"), json.Number("-1e400"), "1.5", "NaN"}
+			if max == math.MaxFloat64 {
+				values = values[1:]
+			}
+			return values[rand.Intn(len(values))]
+		},
+	}
+}
+
+func pickString(values ...string) func(map[string]interface{}) interface{} {
+	return func(map[string]interface{}) interface{} {
+		return values[rand.Intn(len(values))]
+	}
+}
+
+func randomTime() time.Time {
+	return time.Unix(rand.Int63n(4102444800), 0).UTC()
+}
+
+func randomLabel() string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	label := make([]byte, 1+rand.Intn(12))
+	for i := range label {
+		label[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(label)
+}
+
+func randomHostname() string {
+	tlds := []string{"com", "org", "net", "io", "dev"}
+	return randomLabel() + "." + tlds[rand.Intn(len(tlds))]
+}
+
+func randomURI() string {
+	schemes := []string{"http", "https"}
+	uri := schemes[rand.Intn(len(schemes))] + "://" + randomHostname()
+	if rand.Intn(2) == 0 {
+		uri += fmt.Sprintf(":%d", 1+rand.Intn(65535))
+	}
+	uri += "/" + randomLabel()
+	if rand.Intn(2) == 0 {
+		uri += "?q=" + randomLabel()
+	}
+	return uri
+}
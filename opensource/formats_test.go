@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var formatCheckers = map[string]func(string) error{
+	"date": func(s string) error {
+		_, err := time.Parse("2006-01-02", s)
+		return err
+	},
+	"date-time": func(s string) error {
+		_, err := time.Parse(time.RFC3339, s)
+		return err
+	},
+	"uuid": func(s string) error {
+		_, err := uuid.Parse(s)
+		return err
+	},
+	"byte": func(s string) error {
+		_, err := base64.StdEncoding.DecodeString(s)
+		return err
+	},
+	"ipv4": func(s string) error {
+		if ip := net.ParseIP(s); ip == nil || ip.To4() == nil {
+			return &net.ParseError{Type: "IPv4 address", Text: s}
+		}
+		return nil
+	},
+	"ipv6": func(s string) error {
+		if net.ParseIP(s) == nil {
+			return &net.ParseError{Type: "IPv6 address", Text: s}
+		}
+		return nil
+	},
+}
+
+func TestFormatGenerators(t *testing.T) {
+	for format, check := range formatCheckers {
+		generator := formatGenerators[format]
+		for i := 0; i < 50; i++ {
+			valid := generator.Valid(nil).(string)
+			if err := check(valid); err != nil {
+				t.Errorf("%s: valid value %q rejected: %v", format, valid, err)
+			}
+			malformed := generator.Malformed(nil).(string)
+			if err := check(malformed); err == nil {
+				t.Errorf("%s: malformed value %q accepted", format, malformed)
+			}
+		}
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("sku", FormatGenerator{
+		Valid: func(map[string]interface{}) interface{} { return "SKU-1" },
+	})
+	defer delete(formatGenerators, "sku")
+
+	value := generateRandomValue(map[string]interface{}{"type": "string", "format": "sku"})
+	if value != "SKU-1" {
+		t.Errorf("registered format not used: got %v", value)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/google/uuid"
+)
+
+// Probabilities used when a schema leaves the generator a choice. They are
+// deliberately not 0 or 1 so that both sides of optional handling in the
+// target get exercised.
+const (
+	optionalPropertyChance = 0.75
+	defaultValueChance     = 0.2
+	nullValueChance        = 0.1
+)
+
+// defaultMaxItems and defaultMaxLength bound arrays and strings whose schema
+// has no upper limit.
+const (
+	defaultMaxItems  = 4
+	defaultMaxLength = 36
+)
+
+// generateRandomData builds a request object for schema. Required properties
+// are always present, optional ones most of the time; readOnly properties
+// are left out since servers must ignore them in requests.
+func generateRandomData(schema map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+	properties, _ := schema["properties"].(map[string]interface{})
+	required := requiredSet(schema)
+	for key, prop := range properties {
+		propMap, ok := prop.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if readOnly, _ := propMap["readOnly"].(bool); readOnly {
+			continue
+		}
+		if !required[key] && rand.Float64() >= optionalPropertyChance {
+			continue
+		}
+		data[key] = generateFieldValue(key, propMap)
+	}
+
+	// exercise additionalProperties every so often
+	if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok && (len(properties) == 0 || rand.Intn(4) == 0) {
+		for i := 0; i < 1+rand.Intn(3); i++ {
+			data[randomString()[:8]] = generateRandomValue(additional)
+		}
+	}
+
+	// fill up to minProperties with fresh keys
+	if minProps, ok := schemaNumber(schema, "minProperties"); ok {
+		for len(data) < int(minProps) {
+			data[randomString()[:8]] = randomString()
+		}
+	}
+	return data
+}
+
+// generateFieldValue generates a value for a named property or parameter,
+// preferring realistic data when the name says what the field holds.
+func generateFieldValue(name string, schema map[string]interface{}) interface{} {
+	if value, ok := generateSemantic(name, schema); ok {
+		return value
+	}
+	return generateRandomValue(schema)
+}
+
+func generateRandomValue(schema map[string]interface{}) interface{} {
+	if _, ok := schema[circularRefKey]; ok {
+		return nil
+	}
+	if constValue, ok := schema["const"]; ok {
+		return constValue
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[rand.Intn(len(enum))]
+	}
+	if defaultValue, ok := schema["default"]; ok && rand.Float64() < defaultValueChance {
+		return defaultValue
+	}
+	if schemaNullable(schema) && rand.Float64() < nullValueChance {
+		return nil
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if choices, ok := schema[key].([]interface{}); ok && len(choices) > 0 {
+			return generateRandomValue(choices[rand.Intn(len(choices))].(map[string]interface{}))
+		}
+	}
+	t := schemaType(schema)
+	if t == "" && schema["properties"] != nil {
+		t = "object"
+	}
+	if _, hasPattern := schema["pattern"]; !hasPattern && t != "object" && t != "array" {
+		if value, ok := generateFormat(schema); ok {
+			return value
+		}
+	}
+	switch t {
+	case "string":
+		return generateString(schema)
+	case "integer":
+		return generateInteger(schema)
+	case "number":
+		return generateNumber(schema)
+	case "boolean":
+		return rand.Intn(2) == 1
+	case "object":
+		return generateRandomData(schema)
+	case "array":
+		return generateArray(schema)
+	default:
+		return nil
+	}
+}
+
+// generateString returns a random string whose length honors minLength and
+// maxLength. A pattern takes precedence: the string is generated from the
+// regular expression, and now and then deliberately misses it by one
+// character so that the target's rejection path is covered too.
+func generateString(schema map[string]interface{}) string {
+	if pattern, ok := schema["pattern"].(string); ok {
+		generate := generateFromPattern
+		if rand.Float64() < nearMissChance {
+			generate = nearMissFromPattern
+		}
+		value, err := generate(pattern)
+		if err == nil {
+			return value
+		}
+		fmt.Println("Error generating pattern string:", err)
+	}
+
+	minLength, maxLength := 0, defaultMaxLength
+	if v, ok := schemaNumber(schema, "minLength"); ok {
+		minLength = int(v)
+	}
+	if v, ok := schemaNumber(schema, "maxLength"); ok {
+		maxLength = int(v)
+	} else if minLength > maxLength {
+		maxLength = minLength
+	}
+	if maxLength < minLength {
+		maxLength = minLength
+	}
+
+	value := randomString()
+	if _, bounded := schema["maxLength"]; !bounded && minLength == 0 {
+		return value
+	}
+	length := minLength + rand.Intn(maxLength-minLength+1)
+	for len(value) < length {
+		value += randomString()
+	}
+	return value[:length]
+}
+
+// generateInteger returns an integer inside the schema's bounds that is a
+// multiple of multipleOf, when given. When no integer fits the bounds it
+// returns a number inside them instead.
+func generateInteger(schema map[string]interface{}) interface{} {
+	low, high := numericBounds(schema, 0, 100)
+	if exclusiveLow(schema) {
+		low = math.Floor(low) + 1
+	} else {
+		low = math.Ceil(low)
+	}
+	if exclusiveHigh(schema) {
+		high = math.Ceil(high) - 1
+	} else {
+		high = math.Floor(high)
+	}
+	if high < low {
+		return generateNumber(schema)
+	}
+
+	if step, ok := schemaNumber(schema, "multipleOf"); ok && step >= 1 {
+		first, last := math.Ceil(low/step), math.Floor(high/step)
+		if last >= first && last-first < math.MaxInt64 {
+			return clampInt64((first + float64(rand.Int63n(int64(last-first)+1))) * step)
+		}
+	}
+	lo, hi := clampInt64(low), clampInt64(high)
+	// the span of wide bounds does not fit an int64, so the offset is drawn
+	// in uint64 space, where adding it to lo wraps back into range
+	span := uint64(hi) - uint64(lo)
+	if span < math.MaxInt64 {
+		return lo + rand.Int63n(int64(span)+1)
+	}
+	offset := rand.Uint64()
+	for offset > span {
+		offset = rand.Uint64()
+	}
+	return int64(uint64(lo) + offset)
+}
+
+// clampInt64 converts f to an int64, saturating at the ends of the range
+// instead of overflowing.
+func clampInt64(f float64) int64 {
+	switch {
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(f)
+}
+
+// generateNumber returns a floating point number inside the schema's bounds.
+// When exclusive bounds leave no number between them it returns the lower
+// bound.
+func generateNumber(schema map[string]interface{}) float64 {
+	low, high := numericBounds(schema, 0, 100)
+	if high < low {
+		return low
+	}
+	if step, ok := schemaNumber(schema, "multipleOf"); ok && step > 0 {
+		first, last := math.Ceil(low/step), math.Floor(high/step)
+		if exclusiveLow(schema) && first*step == low {
+			first++
+		}
+		if exclusiveHigh(schema) && last*step == high {
+			last--
+		}
+		if last >= first && last-first < math.MaxInt64 {
+			return (first + float64(rand.Int63n(int64(last-first)+1))) * step
+		}
+		if last >= first {
+			// too many multiples to count them in an int64
+			return (first + math.Round(rand.Float64()*(last-first))) * step
+		}
+	}
+	from, to := low, high
+	if exclusiveLow(schema) {
+		from = math.Nextafter(low, math.Inf(1))
+	}
+	if exclusiveHigh(schema) {
+		to = math.Nextafter(high, math.Inf(-1))
+	}
+	if to < from {
+		return low
+	}
+	return math.Min(from+rand.Float64()*(to-from), to)
+}
+
+// generateArray returns an array with between minItems and maxItems elements,
+// all distinct when uniqueItems is set.
+func generateArray(schema map[string]interface{}) []interface{} {
+	itemSchema, _ := schema["items"].(map[string]interface{})
+	minItems, maxItems := 1, defaultMaxItems
+	if v, ok := schemaNumber(schema, "minItems"); ok {
+		minItems = int(v)
+	}
+	if v, ok := schemaNumber(schema, "maxItems"); ok {
+		maxItems = int(v)
+	}
+	if maxItems < minItems {
+		maxItems = minItems
+	}
+	count := minItems + rand.Intn(maxItems-minItems+1)
+	unique, _ := schema["uniqueItems"].(bool)
+
+	items := make([]interface{}, 0, count)
+	for attempts := 0; len(items) < count && attempts < count*10; attempts++ {
+		item := generateRandomValue(itemSchema)
+		if unique && containsJSON(items, item) {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// numericBounds returns the minimum and maximum of a numeric schema. When only
+// one bound is given the other is placed a fixed distance away from it.
+func numericBounds(schema map[string]interface{}, defaultLow, defaultHigh float64) (float64, float64) {
+	low, hasLow := schemaNumber(schema, "minimum")
+	high, hasHigh := schemaNumber(schema, "maximum")
+	// OpenAPI 3.1 uses numeric exclusive bounds instead of booleans.
+	if v, ok := schemaNumber(schema, "exclusiveMinimum"); ok {
+		low, hasLow = v, true
+	}
+	if v, ok := schemaNumber(schema, "exclusiveMaximum"); ok {
+		high, hasHigh = v, true
+	}
+	switch {
+	case !hasLow && !hasHigh:
+		return defaultLow, defaultHigh
+	case !hasLow:
+		return high - (defaultHigh - defaultLow), high
+	case !hasHigh:
+		return low, low + (defaultHigh - defaultLow)
+	}
+	return low, high
+}
+
+func exclusiveLow(schema map[string]interface{}) bool {
+	return exclusiveBound(schema, "exclusiveMinimum")
+}
+
+func exclusiveHigh(schema map[string]interface{}) bool {
+	return exclusiveBound(schema, "exclusiveMaximum")
+}
+
+// exclusiveBound reports whether a bound is exclusive, in either the boolean
+// (Swagger 2.0, OpenAPI 3.0) or numeric (OpenAPI 3.1) form.
+func exclusiveBound(schema map[string]interface{}, key string) bool {
+	if exclusive, ok := schema[key].(bool); ok {
+		return exclusive
+	}
+	_, ok := schemaNumber(schema, key)
+	return ok
+}
+
+// schemaNumber reads a numeric keyword. YAML decodes integers as int while
+// JSON decodes every number as float64.
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	switch v := schema[key].(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// schemaNullable reports whether null is a valid value for schema.
+func schemaNullable(schema map[string]interface{}) bool {
+	if nullable, _ := schema["nullable"].(bool); nullable {
+		return true
+	}
+	if nullable, _ := schema["x-nullable"].(bool); nullable {
+		return true
+	}
+	return schemaAllowsNull(schema)
+}
+
+// requiredSet returns the names listed in an object schema's required.
+func requiredSet(schema map[string]interface{}) map[string]bool {
+	required := make(map[string]bool)
+	if list, ok := schema["required"].([]interface{}); ok {
+		for _, name := range list {
+			required[fmt.Sprintf("%v", name)] = true
+		}
+	}
+	return required
+}
+
+func containsJSON(items []interface{}, item interface{}) bool {
+	for _, existing := range items {
+		if jsonEqual(existing, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaType returns the type of a schema. OpenAPI 3.1 allows a list of
+// types such as [string, null]; the first non-null entry is used. A schema
+// whose only type is null reports "null".
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, entry := range t {
+			if name, ok := entry.(string); ok && name != "null" {
+				return name
+			}
+		}
+		if len(t) > 0 {
+			return "null"
+		}
+	}
+	return ""
+}
+
+func randomString() string {
+	return uuid.New().String()
+}
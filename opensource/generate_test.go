@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGenerateHonorsConstraints(t *testing.T) {
+	schema := resolveRefSchema(map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"id", "quantity", "price", "tags", "status", "note"},
+		"properties": map[string]interface{}{
+			"id":       map[string]interface{}{"type": "integer", "readOnly": true},
+			"quantity": map[string]interface{}{"type": "integer", "minimum": 10, "maximum": 20, "exclusiveMaximum": true, "multipleOf": 5},
+			"price":    map[string]interface{}{"type": "number", "exclusiveMinimum": 0.5, "maximum": 1.5},
+			"tags":     map[string]interface{}{"type": "array", "minItems": 2, "maxItems": 3, "uniqueItems": true, "items": map[string]interface{}{"type": "boolean"}},
+			"status":   map[string]interface{}{"type": "string", "enum": []interface{}{"active", "disabled"}},
+			"note":     map[string]interface{}{"type": "string", "minLength": 40, "maxLength": 50, "nullable": true},
+			"nothing":  map[string]interface{}{"type": "null"},
+		},
+	})
+
+	for i := 0; i < 200; i++ {
+		value := generateRandomData(schema)
+		if _, ok := value["id"]; ok {
+			t.Fatal("readOnly property was generated")
+		}
+		if value["nothing"] != nil {
+			t.Fatalf("null type generated %v", value["nothing"])
+		}
+		// a readOnly id is required in responses, not in requests
+		value["id"] = 1
+		if problems := validateSchema(schema, jsonRoundTrip(value), ""); len(problems) != 0 {
+			t.Fatalf("generated %v violates its schema: %v", value, problems)
+		}
+	}
+}
+
+func TestGenerateIntegerWideBounds(t *testing.T) {
+	for _, bounds := range [][2]int64{
+		{math.MinInt64, math.MaxInt64},
+		{-1, math.MaxInt64},
+		{math.MinInt64, 1},
+		{math.MaxInt64 - 10, math.MaxInt64},
+	} {
+		schema := map[string]interface{}{"type": "integer", "minimum": float64(bounds[0]), "maximum": float64(bounds[1])}
+		for i := 0; i < 1000; i++ {
+			value := generateInteger(schema).(int64)
+			if value < bounds[0] || value > bounds[1] {
+				t.Fatalf("%d outside [%d, %d]", value, bounds[0], bounds[1])
+			}
+		}
+	}
+}
+
+func TestGenerateNarrowBounds(t *testing.T) {
+	// 2 is the only integer above 1.5 and at most 2
+	schema := map[string]interface{}{"type": "integer", "minimum": 1.5, "exclusiveMinimum": true, "maximum": 2.0}
+	for i := 0; i < 100; i++ {
+		if value := generateInteger(schema); value != int64(2) {
+			t.Fatalf("want 2, got %v", value)
+		}
+	}
+	// no integer fits, but a number inside the bounds does
+	schema = map[string]interface{}{"type": "integer", "minimum": 1.2, "maximum": 1.8}
+	if value := generateInteger(schema); value.(float64) < 1.2 || value.(float64) > 1.8 {
+		t.Errorf("value outside [1.2, 1.8]: %v", value)
+	}
+
+	done := make(chan float64)
+	go func() {
+		done <- generateNumber(map[string]interface{}{"type": "number", "minimum": 5.0, "maximum": 5.0, "exclusiveMaximum": true})
+	}()
+	select {
+	case value := <-done:
+		if value != 5 {
+			t.Errorf("want the lower bound, got %v", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("generateNumber does not return for an empty exclusive range")
+	}
+
+	schema = map[string]interface{}{"type": "number", "minimum": 0.0, "maximum": 1e18, "multipleOf": 0.01}
+	for i := 0; i < 100; i++ {
+		if value := generateNumber(schema); value < 0 || value > 1e18 {
+			t.Fatalf("value outside [0, 1e18]: %v", value)
+		}
+	}
+}
@@ -2,12 +2,14 @@ module muskinfra
 
 go 1.22.2
 
-require github.com/tidwall/gjson v1.17.1
+require (
+	github.com/bxcodec/faker/v3 v3.8.1
+	github.com/google/uuid v1.6.0
+	github.com/tidwall/gjson v1.17.1
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
-	github.com/bxcodec/faker/v3 v3.8.1 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
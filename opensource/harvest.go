@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// harvestedChance is how often a parameter with a harvested candidate uses it
+// rather than a freshly generated value. Path parameters almost always need
+// an existing resource, so they use harvested values more eagerly.
+const (
+	harvestedChance     = 0.5
+	harvestedPathChance = 0.8
+)
+
+// maxHarvestedValues bounds how many values are remembered per name; older
+// values are dropped first.
+const maxHarvestedValues = 32
+
+// pathTemplate matches a templated path segment such as {orgId}.
+var pathTemplate = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// valuePool remembers scalar values seen in responses, keyed by normalized
+// field name, so that later requests can refer to resources that exist.
+type valuePool struct {
+	values map[string][]interface{}
+}
+
+var harvested = newValuePool()
+
+func newValuePool() *valuePool {
+	return &valuePool{values: make(map[string][]interface{})}
+}
+
+// addResponse records every scalar field in a decoded response body. A
+// top-level "id" returned by an operation on /orgs/{orgId}/users is also
+// recorded as userId, since that is how other operations tend to name it.
+func (p *valuePool) addResponse(endpoint EndpointInfo, response interface{}) {
+	resource := resourceName(endpoint.Path)
+	var walk func(value interface{}, topLevel bool)
+	walk = func(value interface{}, topLevel bool) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, field := range v {
+				switch field.(type) {
+				case map[string]interface{}, []interface{}:
+					walk(field, false)
+					continue
+				case nil:
+					continue
+				}
+				p.add(key, field)
+				if topLevel && resource != "" && normalizeName(key) == "id" {
+					p.add(resource+"Id", field)
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item, topLevel)
+			}
+		}
+	}
+	walk(response, true)
+}
+
+// add remembers value under name.
+func (p *valuePool) add(name string, value interface{}) {
+	key := normalizeName(name)
+	for _, existing := range p.values[key] {
+		if jsonEqual(existing, value) {
+			return
+		}
+	}
+	values := append(p.values[key], value)
+	if len(values) > maxHarvestedValues {
+		values = values[len(values)-maxHarvestedValues:]
+	}
+	p.values[key] = values
+}
+
+// lookup returns a random remembered value for name. A bare "id" parameter
+// takes the <resource>Id values of the resource the path is about and falls
+// back to the ids of any resource only when there are none.
+func (p *valuePool) lookup(name, path string) (interface{}, bool) {
+	candidates := []string{normalizeName(name)}
+	if normalizeName(name) == "id" {
+		if resource := resourceName(path); resource != "" {
+			candidates = append([]string{normalizeName(resource + "Id")}, candidates...)
+		}
+	}
+	for _, key := range candidates {
+		if values := p.values[key]; len(values) > 0 {
+			return values[rand.Intn(len(values))], true
+		}
+	}
+	return nil, false
+}
+
+// normalizeName folds userId, user_id and UserID into the same key.
+func normalizeName(name string) string {
+	return strings.Join(fieldTokens(name), "")
+}
+
+// resourceName guesses the resource a path operates on from its last literal
+// segment, singularised: /orgs/{orgId}/users/{id} is about a "user".
+func resourceName(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if segment == "" || pathTemplate.MatchString(segment) {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(segment, "ies"):
+			return strings.TrimSuffix(segment, "ies") + "y"
+		case strings.HasSuffix(segment, "sses"):
+			return strings.TrimSuffix(segment, "es")
+		case strings.HasSuffix(segment, "s") && !strings.HasSuffix(segment, "ss"):
+			return strings.TrimSuffix(segment, "s")
+		}
+		return segment
+	}
+	return ""
+}
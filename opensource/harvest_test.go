@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResourceName(t *testing.T) {
+	tests := map[string]string{
+		"/users":                   "user",
+		"/user/{id}":               "user",
+		"/orgs/{orgId}/users/{id}": "user",
+		"/categories":              "category",
+		"/addresses/{name}":        "address",
+		"/{tenant}":                "",
+	}
+	for path, want := range tests {
+		if got := resourceName(path); got != want {
+			t.Errorf("resourceName(%q): got %q want %q", path, got, want)
+		}
+	}
+}
+
+func TestHarvestedPathParameters(t *testing.T) {
+	defer func() { harvested = newValuePool() }()
+	harvested = newValuePool()
+	harvested.addResponse(EndpointInfo{Path: "/orgs", Method: "post"}, map[string]interface{}{"id": 42.0, "name": "acme"})
+	harvested.addResponse(EndpointInfo{Path: "/orgs/{orgId}/users", Method: "get"}, []interface{}{
+		map[string]interface{}{"id": 7.0, "team": map[string]interface{}{"team_id": "t-1"}},
+	})
+
+	if value, ok := harvested.lookup("org_id", "/orgs/{orgId}"); !ok || value != 42.0 {
+		t.Errorf("orgId not harvested: got %v", value)
+	}
+	if value, ok := harvested.lookup("teamId", "/teams/{teamId}"); !ok || value != "t-1" {
+		t.Errorf("nested teamId not harvested: got %v", value)
+	}
+
+	// {orgId} is declared, {userId} is not; both must be filled
+	endpoint := EndpointInfo{
+		Path:   "/orgs/{orgId}/users/{userId}",
+		Method: "get",
+		Parameters: []ParameterInfo{
+			{Name: "orgId", In: "path", Type: "integer", Required: true, Schema: map[string]interface{}{"type": "integer"}},
+		},
+	}
+	req, err := buildRequest(endpoint, generateInput(endpoint, map[string]interface{}{"orgId": 42}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/orgs/42/users/7" {
+		t.Errorf("templated segments not substituted: got %s", req.URL.Path)
+	}
+	if strings.ContainsAny(req.URL.Path, "{}") {
+		t.Errorf("template left in path: %s", req.URL.Path)
+	}
+}
+
+func TestLookupPrefersResourceIDs(t *testing.T) {
+	p := newValuePool()
+	p.addResponse(EndpointInfo{Path: "/orgs", Method: "post"}, map[string]interface{}{"id": 42.0})
+	p.addResponse(EndpointInfo{Path: "/user", Method: "post"}, map[string]interface{}{"id": 7.0})
+
+	for i := 0; i < 50; i++ {
+		if value, _ := p.lookup("id", "/user/{id}"); value != 7.0 {
+			t.Fatalf("/user/{id} filled with %v", value)
+		}
+		if value, _ := p.lookup("id", "/orgs/{id}"); value != 42.0 {
+			t.Fatalf("/orgs/{id} filled with %v", value)
+		}
+	}
+	// without ids of its own a resource takes any id
+	if _, ok := p.lookup("id", "/orders/{id}"); !ok {
+		t.Error("no fallback to generic ids")
+	}
+}
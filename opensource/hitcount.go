@@ -0,0 +1,67 @@
+package main
+
+import "fmt"
+
+// hitBucket maps how often a request ran a block onto AFL's hit-count
+// buckets: 1, 2, 3, 4-7, 8-15, 16-31, 32-127 and 128 or more, one bit
+// each. Counts inside a bucket are treated as the same behaviour, so that a
+// loop running 9 instead of 10 times is not new, but one running 40 instead
+// of 10 times is.
+func hitBucket(count int) uint8 {
+	switch {
+	case count <= 0:
+		return 0
+	case count <= 3:
+		return 1 << (count - 1)
+	case count <= 7:
+		return 1 << 3
+	case count <= 15:
+		return 1 << 4
+	case count <= 31:
+		return 1 << 5
+	case count <= 127:
+		return 1 << 6
+	}
+	return 1 << 7
+}
+
+// hitMap holds, per block ID, the buckets of all hit counts seen for it.
+type hitMap map[string]uint8
+
+// add records the hit counts of blocks and returns how many of them fell
+// into a bucket not seen before for their block.
+func (h hitMap) add(blocks []coverageBlock) int {
+	found := 0
+	for _, block := range blocks {
+		bucket := hitBucket(block.Count)
+		if bucket != 0 && h[block.ID]&bucket == 0 {
+			h[block.ID] |= bucket
+			found++
+		}
+	}
+	return found
+}
+
+// size counts the (block, bucket) pairs seen so far.
+func (h hitMap) size() int {
+	n := 0
+	for _, buckets := range h {
+		for ; buckets != 0; buckets &= buckets - 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// checkCoverMode warns about targets whose counters cannot be read and
+// reports whether they can. The runtime only hands out the counters of
+// -covermode=atomic builds, so the coverage endpoints of set and count
+// builds fail and report nothing but the mode.
+func checkCoverMode(mode string) bool {
+	switch mode {
+	case "set", "count":
+		fmt.Printf("Warning: the target was built with -covermode=%s, its counters cannot be read while it runs; coverage feedback and hit-count buckets are disabled. Rebuild it with -covermode=atomic.\n", mode)
+		return false
+	}
+	return true
+}
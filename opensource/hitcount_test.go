@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHitBucket(t *testing.T) {
+	for count, want := range map[int]uint8{0: 0, 1: 1, 2: 2, 3: 4, 4: 8, 7: 8, 8: 16, 15: 16, 16: 32, 31: 32, 32: 64, 127: 64, 128: 128, 100000: 128} {
+		if got := hitBucket(count); got != want {
+			t.Errorf("hitBucket(%d) = %d, want %d", count, got, want)
+		}
+	}
+}
+
+func TestHitMapAdd(t *testing.T) {
+	h := make(hitMap)
+	if n := h.add([]coverageBlock{{ID: "a", Count: 1}, {ID: "b", Count: 10}}); n != 2 {
+		t.Errorf("first hits not new: %d", n)
+	}
+	// 12 runs are in the same bucket as 10, 40 are not
+	if n := h.add([]coverageBlock{{ID: "a", Count: 1}, {ID: "b", Count: 12}}); n != 0 {
+		t.Errorf("same buckets counted as new: %d", n)
+	}
+	if n := h.add([]coverageBlock{{ID: "b", Count: 40}}); n != 1 {
+		t.Errorf("more loop iterations not counted as new: %d", n)
+	}
+	if h.size() != 3 {
+		t.Errorf("wrong number of buckets: %d", h.size())
+	}
+}
+
+func TestCheckCoverMode(t *testing.T) {
+	if checkCoverMode("set") || checkCoverMode("count") {
+		t.Error("coverage enabled for a target whose counters cannot be read")
+	}
+	if !checkCoverMode("atomic") || !checkCoverMode("") {
+		t.Error("coverage disabled for an atomic target")
+	}
+}
+
+func TestFetchCoverageReportsModeOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": "coverage counters unavailable", "mode": "set"}`))
+	}))
+	defer server.Close()
+	defer func(old string) { baseURL = old }(baseURL)
+	baseURL = server.URL
+
+	report, err := fetchCoverage()
+	if err == nil || report.Mode != "set" {
+		t.Errorf("want an error and mode set, got %q (%v)", report.Mode, err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// malformedChance is how often a mutated sequence also gets one body
+// replaced by a syntactically broken payload. Set with -malformed.
+var malformedChance = 0.1
+
+// maxMalformedNesting bounds the deeply nested arrays; Go's decoder gives up
+// at 10000 levels, so both sides of that limit get tried.
+const maxMalformedNesting = 20000
+
+// malformedKind is one way of breaking a JSON payload. It gets the encoded
+// body and returns the bytes to send and, if it must differ from the
+// endpoint's, the Content-Type to send them with.
+type malformedKind struct {
+	name    string
+	malform func(encoded []byte) ([]byte, string)
+}
+
+var malformedKinds = []malformedKind{
+	{"truncated", truncateJSON},
+	{"trailing-garbage", appendGarbage},
+	{"invalid-utf8", insertInvalidUTF8},
+	{"unterminated-string", unterminateString},
+	{"huge-number", insertHugeNumber},
+	{"deeply-nested", nestArrays},
+	{"bom-prefix", prefixBOM},
+	{"wrong-content-type", mismatchContentType},
+}
+
+// malformBody replaces the body of input by a broken encoding of it.
+func malformBody(input *requestInput) {
+	encoded, err := json.Marshal(input.Body)
+	if err != nil || input.Body == nil {
+		encoded = []byte(`{}`)
+	}
+	kind := malformedKinds[rand.Intn(len(malformedKinds))]
+	input.RawBody, input.ContentType = kind.malform(encoded)
+	input.Malformed = kind.name
+}
+
+func truncateJSON(encoded []byte) ([]byte, string) {
+	if len(encoded) < 2 {
+		return []byte(`{`), ""
+	}
+	return encoded[:1+rand.Intn(len(encoded)-1)], ""
+}
+
+var garbage = []string{"}", "]", ",", "garbage", `{"id":1}`, "\x00", "\n\n--", " null"}
+
+func appendGarbage(encoded []byte) ([]byte, string) {
+	return append(append([]byte{}, encoded...), garbage[rand.Intn(len(garbage))]...), ""
+}
+
+var invalidUTF8 = []string{"\xff", "\xfe\xff", "\xc3\x28", "\xe2\x82", "\xed\xa0\x80", "\xf8\x88\x80\x80\x80"}
+
+// insertInvalidUTF8 puts invalid byte sequences into a string value, or
+// anywhere if there is none.
+func insertInvalidUTF8(encoded []byte) ([]byte, string) {
+	seq := invalidUTF8[rand.Intn(len(invalidUTF8))]
+	pos := rand.Intn(len(encoded) + 1)
+	if quotes := stringStarts(encoded); len(quotes) > 0 {
+		pos = quotes[rand.Intn(len(quotes))] + 1
+	}
+	return spliceBytes(encoded, pos, 0, seq), ""
+}
+
+// unterminateString cuts the payload off inside a string value.
+func unterminateString(encoded []byte) ([]byte, string) {
+	quotes := stringStarts(encoded)
+	if len(quotes) == 0 {
+		return append(append([]byte{}, encoded...), `"unterminated`...), ""
+	}
+	pos := quotes[rand.Intn(len(quotes))] + 1
+	return append(append([]byte{}, encoded[:pos]...), "unterminated"...), ""
+}
+
+var (
+	hugeNumbers = []string{
+		"1" + strings.Repeat("0", 400),
+		"-" + strings.Repeat("9", 400),
+		"1e999999",
+		"-1e-999999",
+		"0." + strings.Repeat("0", 400) + "1",
+		"18446744073709551616",
+		"9223372036854775808",
+	}
+	numberValue = regexp.MustCompile(`:-?[0-9][0-9.eE+-]*`)
+)
+
+// insertHugeNumber replaces a number value by one that overflows every
+// numeric type, or adds one.
+func insertHugeNumber(encoded []byte) ([]byte, string) {
+	huge := hugeNumbers[rand.Intn(len(hugeNumbers))]
+	if loc := numberValue.FindIndex(encoded); loc != nil {
+		return spliceBytes(encoded, loc[0], loc[1]-loc[0], ":"+huge), ""
+	}
+	if bytes.HasPrefix(encoded, []byte("{")) {
+		return spliceBytes(encoded, 1, 0, `"id":`+huge+commaIfMembers(encoded)), ""
+	}
+	return []byte(huge), ""
+}
+
+func nestArrays(encoded []byte) ([]byte, string) {
+	n := 1000 + rand.Intn(maxMalformedNesting)
+	var buf bytes.Buffer
+	buf.WriteString(strings.Repeat("[", n))
+	buf.Write(encoded)
+	buf.WriteString(strings.Repeat("]", n))
+	return buf.Bytes(), ""
+}
+
+func prefixBOM(encoded []byte) ([]byte, string) {
+	return append([]byte("\xef\xbb\xbf"), encoded...), ""
+}
+
+var mismatchedContentTypes = []string{
+	"text/plain",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"multipart/form-data",
+	"application/octet-stream",
+	"application/json; charset=utf-16",
+}
+
+// mismatchContentType sends the payload as it is, labelled as something
+// else.
+func mismatchContentType(encoded []byte) ([]byte, string) {
+	return encoded, mismatchedContentTypes[rand.Intn(len(mismatchedContentTypes))]
+}
+
+// stringStarts returns the offsets of the opening quotes of the strings in
+// encoded, keys included.
+func stringStarts(encoded []byte) []int {
+	var starts []int
+	inString := false
+	for i := 0; i < len(encoded); i++ {
+		switch {
+		case inString && encoded[i] == '\\':
+			i++
+		case encoded[i] == '"':
+			if !inString {
+				starts = append(starts, i)
+			}
+			inString = !inString
+		}
+	}
+	return starts
+}
+
+func commaIfMembers(encoded []byte) string {
+	if len(bytes.TrimSpace(encoded)) > 2 {
+		return ","
+	}
+	return ""
+}
+
+// spliceBytes returns a copy of data with n bytes at pos replaced by insert.
+func spliceBytes(data []byte, pos, n int, insert string) []byte {
+	out := make([]byte, 0, len(data)+len(insert))
+	out = append(out, data[:pos]...)
+	out = append(out, insert...)
+	return append(out, data[pos+n:]...)
+}
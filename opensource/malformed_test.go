@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMalformedKinds(t *testing.T) {
+	encoded := []byte(`{"id":7,"username":"ash"}`)
+	for _, kind := range malformedKinds {
+		for i := 0; i < 20; i++ {
+			raw, contentType := kind.malform(encoded)
+			switch kind.name {
+			case "wrong-content-type":
+				if !bytes.Equal(raw, encoded) || contentType == "" || contentType == "application/json" {
+					t.Errorf("%s: sent %s as %q", kind.name, raw, contentType)
+				}
+			case "huge-number":
+				if !json.Valid(raw) || bytes.Contains(raw, []byte(":7")) {
+					t.Errorf("%s: number not replaced: %s", kind.name, raw)
+				}
+			case "invalid-utf8":
+				if utf8.Valid(raw) {
+					t.Errorf("%s: payload is valid UTF-8: %q", kind.name, raw)
+				}
+			case "deeply-nested":
+				if !bytes.HasPrefix(raw, bytes.Repeat([]byte("["), 1000)) {
+					t.Errorf("%s: nested less than 1000 levels", kind.name)
+				}
+			default:
+				if json.Valid(raw) {
+					t.Errorf("%s: payload is still valid JSON: %q", kind.name, raw)
+				}
+			}
+			if contentType != "" && kind.name != "wrong-content-type" {
+				t.Errorf("%s: changed the Content-Type to %q", kind.name, contentType)
+			}
+		}
+	}
+}
+
+func TestStringStarts(t *testing.T) {
+	got := stringStarts([]byte(`{"a":"x\"y","b":1}`))
+	if len(got) != 3 || got[0] != 1 || got[1] != 5 || got[2] != 12 {
+		t.Errorf("wrong string offsets: %v", got)
+	}
+}
+
+func TestBuildRequestSendsRawBody(t *testing.T) {
+	endpoint := EndpointInfo{Method: "post", Path: "/user", ContentType: "application/json", RequestBody: map[string]interface{}{"type": "object"}}
+	input := requestInput{Body: map[string]interface{}{"username": "ash"}}
+	malformBody(&input)
+	if input.RawBody == nil || input.Malformed == "" {
+		t.Fatalf("body not malformed: %+v", input)
+	}
+
+	input.RawBody, input.ContentType = []byte(`{"username": "ash"`), "text/plain"
+	req, err := buildRequest(endpoint, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"username": "ash"` || req.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("sent %q as %q", body, req.Header.Get("Content-Type"))
+	}
+
+	input.ContentType = ""
+	req, err = buildRequest(endpoint, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := req.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("raw body sent as %q", ct)
+	}
+}
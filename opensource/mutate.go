@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// maxSlotDepth bounds how deep the mutator looks into a body, so that bodies
+// grown by earlier nesting mutations stay cheap to mutate.
+const maxSlotDepth = 32
+
+// orderedObject is a JSON object that keeps its members in order and may
+// repeat a key. Go maps cannot, so the duplicate-key mutation turns an
+// object into one. A corpus entry saved with duplicate keys is read back
+// with the last value of each key.
+type orderedObject []jsonMember
+
+type jsonMember struct {
+	Key   string
+	Value interface{}
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonSlot is one value of a body tree together with what the schema says
+// about it and a way to replace it. Field is the top-level property the
+// value sits under, "" for the body itself.
+type jsonSlot struct {
+	value  interface{}
+	schema map[string]interface{}
+	field  string
+	depth  int
+	set    func(interface{})
+}
+
+// jsonMutator changes request bodies on the level of their JSON tree. The
+// body schema guides it where it is known, e.g. to pick required fields to
+// delete or to generate a valid replacement value, but mutated bodies are
+// not required to match it: most operators exist to break it.
+type jsonMutator struct {
+	schema map[string]interface{}
+	// donors are bodies of other corpus entries to splice subtrees from.
+	donors []interface{}
+}
+
+// jsonOperator is one kind of structural mutation. It gets every slot of a
+// copy of the body, the body itself first, changes the tree through them
+// and returns the top-level field it changed. ok is false when the body has
+// nothing the operator can work on.
+type jsonOperator struct {
+	name  string
+	apply func(m *jsonMutator, slots []jsonSlot) (field string, ok bool)
+}
+
+var jsonOperators = []jsonOperator{
+	{"change-value", (*jsonMutator).changeValue},
+	{"delete-required", (*jsonMutator).deleteRequired},
+	{"add-unknown-field", (*jsonMutator).addUnknownField},
+	{"swap-type", (*jsonMutator).swapType},
+	{"duplicate-key", (*jsonMutator).duplicateKey},
+	{"nest-deeply", (*jsonMutator).nestDeeply},
+	{"grow-array", (*jsonMutator).growArray},
+	{"splice", (*jsonMutator).splice},
+}
+
+// apply runs one operator on a copy of body.
+func (m *jsonMutator) apply(op jsonOperator, body interface{}) (interface{}, string, bool) {
+	result := copyJSON(body)
+	root := jsonSlot{value: result, schema: m.schema, set: func(v interface{}) { result = v }}
+	field, ok := op.apply(m, collectSlots(root))
+	if !ok {
+		return body, "", false
+	}
+	return result, field, true
+}
+
+// collectSlots lists root and every value below it, parents before their
+// children. Object members are visited in key order.
+func collectSlots(root jsonSlot) []jsonSlot {
+	slots := []jsonSlot{root}
+	for i := 0; i < len(slots); i++ {
+		slot := slots[i]
+		if slot.depth >= maxSlotDepth {
+			continue
+		}
+		child := func(value interface{}, schema map[string]interface{}, field string, set func(interface{})) {
+			if slot.field != "" {
+				field = slot.field
+			}
+			slots = append(slots, jsonSlot{value: value, schema: schema, field: field, depth: slot.depth + 1, set: set})
+		}
+		switch value := slot.value.(type) {
+		case map[string]interface{}:
+			props, _ := slot.schema["properties"].(map[string]interface{})
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				key := key
+				schema, _ := props[key].(map[string]interface{})
+				child(value[key], schema, key, func(v interface{}) { value[key] = v })
+			}
+		case orderedObject:
+			props, _ := slot.schema["properties"].(map[string]interface{})
+			for i := range value {
+				i := i
+				schema, _ := props[value[i].Key].(map[string]interface{})
+				child(value[i].Value, schema, value[i].Key, func(v interface{}) { value[i].Value = v })
+			}
+		case []interface{}:
+			items, _ := slot.schema["items"].(map[string]interface{})
+			for i := range value {
+				i := i
+				child(value[i], items, "", func(v interface{}) { value[i] = v })
+			}
+		}
+	}
+	return slots
+}
+
+// pickSlot returns a random slot that keep accepts.
+func pickSlot(slots []jsonSlot, keep func(jsonSlot) bool) (jsonSlot, bool) {
+	var candidates []jsonSlot
+	for _, slot := range slots {
+		if keep(slot) {
+			candidates = append(candidates, slot)
+		}
+	}
+	if len(candidates) == 0 {
+		return jsonSlot{}, false
+	}
+	return candidates[rand.Intn(len(candidates))], true
+}
+
+func isObject(slot jsonSlot) bool {
+	switch slot.value.(type) {
+	case map[string]interface{}, orderedObject:
+		return true
+	}
+	return false
+}
+
+// memberField is the top-level field a new or removed member key of slot
+// stands for.
+func memberField(slot jsonSlot, key string) string {
+	if slot.depth == 0 {
+		return key
+	}
+	return slot.field
+}
+
+// changeValue replaces a value by one the schema allows or, ignoring it, by
+// an edge case of the value's own type.
+func (m *jsonMutator) changeValue(slots []jsonSlot) (string, bool) {
+	slot, ok := pickSlot(slots, func(s jsonSlot) bool { return s.depth > 0 || !isObject(s) })
+	if !ok {
+		return "", false
+	}
+	if slot.schema != nil && rand.Intn(2) == 0 {
+		slot.set(generateFieldValue(slot.field, slot.schema))
+	} else {
+		slot.set(interestingValue(slot.value))
+	}
+	return slot.field, true
+}
+
+// deleteRequired removes a field of an object, a required one where the
+// schema says which.
+func (m *jsonMutator) deleteRequired(slots []jsonSlot) (string, bool) {
+	slot, ok := pickSlot(slots, func(s jsonSlot) bool {
+		object, ok := s.value.(map[string]interface{})
+		return ok && len(object) > 0
+	})
+	if !ok {
+		return "", false
+	}
+	object := slot.value.(map[string]interface{})
+	var keys []string
+	for key := range requiredSet(slot.schema) {
+		if _, ok := object[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		for key := range object {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	key := keys[rand.Intn(len(keys))]
+	delete(object, key)
+	return memberField(slot, key), true
+}
+
+// unknownFieldNames are field names servers tend to treat specially.
+var unknownFieldNames = []string{"id", "isAdmin", "role", "__proto__", "constructor", "$where", "extra", ""}
+
+// addUnknownField adds a field the schema does not declare.
+func (m *jsonMutator) addUnknownField(slots []jsonSlot) (string, bool) {
+	slot, ok := pickSlot(slots, isObject)
+	if !ok {
+		return "", false
+	}
+	props, _ := slot.schema["properties"].(map[string]interface{})
+	key := unknownFieldNames[rand.Intn(len(unknownFieldNames))]
+	if _, declared := props[key]; declared || rand.Intn(2) == 0 {
+		key = randomString()[:8]
+	}
+	value := randomJSONValue(2)
+	switch object := slot.value.(type) {
+	case map[string]interface{}:
+		object[key] = value
+	case orderedObject:
+		slot.set(append(object, jsonMember{key, value}))
+	}
+	return memberField(slot, key), true
+}
+
+// swapType replaces a value by one of another JSON type, e.g. a string by
+// a number, an object or null.
+func (m *jsonMutator) swapType(slots []jsonSlot) (string, bool) {
+	slot := slots[rand.Intn(len(slots))]
+	slot.set(swappedValue(slot.value))
+	return slot.field, true
+}
+
+// duplicateKey repeats a member of an object with another value. Which of
+// the two a server sees depends on its JSON decoder.
+func (m *jsonMutator) duplicateKey(slots []jsonSlot) (string, bool) {
+	slot, ok := pickSlot(slots, func(s jsonSlot) bool {
+		switch object := s.value.(type) {
+		case map[string]interface{}:
+			return len(object) > 0
+		case orderedObject:
+			return len(object) > 0
+		}
+		return false
+	})
+	if !ok {
+		return "", false
+	}
+	var members orderedObject
+	switch object := slot.value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			members = append(members, jsonMember{key, object[key]})
+		}
+	case orderedObject:
+		members = object
+	}
+	member := members[rand.Intn(len(members))]
+	duplicate := jsonMember{member.Key, swappedValue(member.Value)}
+	if rand.Intn(2) == 0 {
+		duplicate.Value = interestingValue(member.Value)
+	}
+	slot.set(append(members, duplicate))
+	return memberField(slot, member.Key), true
+}
+
+// nestDeeply wraps a value in many levels of arrays and objects, to probe
+// recursion limits of the server's decoder and handlers.
+func (m *jsonMutator) nestDeeply(slots []jsonSlot) (string, bool) {
+	slot := slots[rand.Intn(len(slots))]
+	value := slot.value
+	for n := 16 + rand.Intn(240); n > 0; n-- {
+		if rand.Intn(2) == 0 {
+			value = []interface{}{value}
+		} else {
+			value = map[string]interface{}{"a": value}
+		}
+	}
+	slot.set(value)
+	return slot.field, true
+}
+
+// growArray makes an array much longer, repeating its elements or, for an
+// empty one, filling it with values for its item schema.
+func (m *jsonMutator) growArray(slots []jsonSlot) (string, bool) {
+	slot, ok := pickSlot(slots, func(s jsonSlot) bool {
+		_, ok := s.value.([]interface{})
+		return ok
+	})
+	if !ok {
+		return "", false
+	}
+	items := slot.value.([]interface{})
+	schema, _ := slot.schema["items"].(map[string]interface{})
+	target := 8 << rand.Intn(8)
+	grown := append([]interface{}{}, items...)
+	for len(grown) < target {
+		if len(items) > 0 {
+			grown = append(grown, copyJSON(items[rand.Intn(len(items))]))
+		} else if schema != nil {
+			grown = append(grown, generateRandomValue(schema))
+		} else {
+			grown = append(grown, randomJSONValue(1))
+		}
+	}
+	slot.set(grown)
+	return slot.field, true
+}
+
+// splice replaces a value by a subtree of another corpus entry's body,
+// preferring one found under the same field name.
+func (m *jsonMutator) splice(slots []jsonSlot) (string, bool) {
+	if len(m.donors) == 0 {
+		return "", false
+	}
+	donor := collectSlots(jsonSlot{value: m.donors[rand.Intn(len(m.donors))]})
+	slot := slots[rand.Intn(len(slots))]
+	subtree, ok := pickSlot(donor, func(s jsonSlot) bool { return s.depth > 0 && s.field == slot.field })
+	if !ok {
+		subtree = donor[rand.Intn(len(donor))]
+	}
+	slot.set(copyJSON(subtree.value))
+	return slot.field, true
+}
+
+// interestingStrings and interestingNumbers are edge cases that commonly
+// trip up parsing and validation.
+var (
+	interestingStrings = []string{"", " ", "0", "-1", "null", "true", "%s%n", "' OR '1'='1", "<script>", "\u0000", "🙂", "../../etc/passwd", strings.Repeat("A", 4096)}
+	interestingNumbers = []float64{0, -1, 1, 0.5, 2147483647, -2147483648, 4294967296, 9007199254740993, 1e308, -1e308}
+)
+
+// interestingValue returns an edge case of the same JSON type as value.
+func interestingValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return interestingStrings[rand.Intn(len(interestingStrings))]
+	case float64:
+		if rand.Intn(2) == 0 {
+			n := []float64{v + 1, v - 1, -v, v * 2}[rand.Intn(4)]
+			// JSON has no infinity, so doubling 1e308 stops at the
+			// largest float
+			if math.IsInf(n, 0) {
+				n = math.Copysign(math.MaxFloat64, n)
+			}
+			return n
+		}
+		return interestingNumbers[rand.Intn(len(interestingNumbers))]
+	case bool:
+		return !v
+	case []interface{}:
+		return []interface{}{}
+	case map[string]interface{}, orderedObject:
+		return map[string]interface{}{}
+	}
+	return randomJSONValue(1)
+}
+
+// swappedValue returns a value of another JSON type than value, derived
+// from it where that makes sense, e.g. "42" for 42.
+func swappedValue(value interface{}) interface{} {
+	var candidates []interface{}
+	if _, ok := value.(float64); !ok {
+		candidates = append(candidates, interestingNumbers[rand.Intn(len(interestingNumbers))])
+	}
+	if _, ok := value.(string); !ok {
+		candidates = append(candidates, formatParamValue(value))
+	}
+	if !isObject(jsonSlot{value: value}) {
+		candidates = append(candidates, map[string]interface{}{"value": value})
+	}
+	if _, ok := value.([]interface{}); !ok {
+		candidates = append(candidates, []interface{}{value})
+	}
+	if value != nil {
+		candidates = append(candidates, nil)
+	}
+	if _, ok := value.(bool); !ok {
+		candidates = append(candidates, true)
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// randomJSONValue returns a value of a random JSON type, with containers
+// nested up to depth levels.
+func randomJSONValue(depth int) interface{} {
+	n := 4
+	if depth > 0 {
+		n = 6
+	}
+	switch rand.Intn(n) {
+	case 0:
+		return randomString()
+	case 1:
+		return interestingNumbers[rand.Intn(len(interestingNumbers))]
+	case 2:
+		return rand.Intn(2) == 0
+	case 3:
+		return nil
+	case 4:
+		return []interface{}{randomJSONValue(depth - 1)}
+	}
+	return map[string]interface{}{randomString()[:8]: randomJSONValue(depth - 1)}
+}
+
+// copyJSON deep-copies a decoded JSON value, so that mutations do not reach
+// the corpus entry it came from.
+func copyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyJSON(item)
+		}
+		return copied
+	case orderedObject:
+		copied := make(orderedObject, len(v))
+		for i, member := range v {
+			copied[i] = jsonMember{member.Key, copyJSON(member.Value)}
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyJSON(item)
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func userSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"username"},
+		"properties": map[string]interface{}{
+			"id":       map[string]interface{}{"type": "integer"},
+			"username": map[string]interface{}{"type": "string"},
+			"tags":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+}
+
+func sampleBody() map[string]interface{} {
+	return map[string]interface{}{"id": float64(7), "username": "ash", "tags": []interface{}{"a"}}
+}
+
+func operator(t *testing.T, name string) jsonOperator {
+	for _, op := range jsonOperators {
+		if op.name == name {
+			return op
+		}
+	}
+	t.Fatalf("no operator %s", name)
+	return jsonOperator{}
+}
+
+func TestJSONOperators(t *testing.T) {
+	m := &jsonMutator{schema: userSchema(), donors: []interface{}{map[string]interface{}{"username": map[string]interface{}{"first": "misty"}}}}
+	body := sampleBody()
+
+	for i := 0; i < 20; i++ {
+		result, field, ok := m.apply(operator(t, "delete-required"), body)
+		if !ok || field != "username" {
+			t.Fatalf("delete-required removed %q", field)
+		}
+		if _, ok := result.(map[string]interface{})["username"]; ok {
+			t.Errorf("required field still present: %v", result)
+		}
+	}
+
+	result, field, ok := m.apply(operator(t, "add-unknown-field"), body)
+	if !ok || len(result.(map[string]interface{})) != 4 {
+		t.Errorf("add-unknown-field added nothing: %v (%s)", result, field)
+	}
+
+	result, field, ok = m.apply(operator(t, "duplicate-key"), body)
+	encoded, _ := json.Marshal(result)
+	if !ok || strings.Count(string(encoded), `"`+field+`":`) != 2 {
+		t.Errorf("duplicate-key did not repeat %q: %s", field, encoded)
+	}
+
+	result, _, ok = m.apply(operator(t, "grow-array"), body)
+	if tags := result.(map[string]interface{})["tags"].([]interface{}); !ok || len(tags) < 8 {
+		t.Errorf("grow-array left %d tags", len(tags))
+	}
+
+	result, _, _ = m.apply(operator(t, "nest-deeply"), body)
+	encoded, _ = json.Marshal(result)
+	if depth := strings.Count(string(encoded), "[") + strings.Count(string(encoded), "{"); depth < 16 {
+		t.Errorf("nest-deeply nested only %d levels: %s", depth, encoded)
+	}
+
+	for i := 0; i < 20; i++ {
+		result, field, _ = m.apply(operator(t, "swap-type"), body)
+		if field == "" {
+			continue
+		}
+		before, _ := json.Marshal(body[field])
+		after, _ := json.Marshal(result.(map[string]interface{})[field])
+		if string(before) == string(after) {
+			t.Errorf("swap-type kept %s for %s", after, field)
+		}
+	}
+
+	spliced := false
+	for i := 0; i < 50 && !spliced; i++ {
+		result, _, _ = m.apply(operator(t, "splice"), body)
+		encoded, _ = json.Marshal(result)
+		spliced = strings.Contains(string(encoded), "misty")
+	}
+	if !spliced {
+		t.Error("splice never took a subtree from the donor")
+	}
+
+	if !jsonEqual(body, sampleBody()) {
+		t.Errorf("mutations changed the original body: %v", body)
+	}
+}
+
+func TestJSONMutatorWithoutSchema(t *testing.T) {
+	m := &jsonMutator{}
+	for _, body := range []interface{}{"text", float64(1), nil, []interface{}{}, map[string]interface{}{}} {
+		for _, op := range jsonOperators {
+			result, _, _ := m.apply(op, body)
+			if _, err := json.Marshal(result); err != nil {
+				t.Errorf("%s on %v gave an unencodable body: %v", op.name, body, err)
+			}
+		}
+	}
+	if _, _, ok := m.apply(operator(t, "splice"), "text"); ok {
+		t.Error("spliced without donors")
+	}
+}
+
+func TestOrderedObjectKeepsDuplicates(t *testing.T) {
+	encoded, err := json.Marshal(orderedObject{{"id", float64(1)}, {"id", "x"}, {"n", nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"id":1,"id":"x","n":null}` {
+		t.Errorf("wrong encoding: %s", encoded)
+	}
+}
+
+func TestInterestingValueStaysFinite(t *testing.T) {
+	for _, v := range []float64{1e308, -1e308, math.MaxFloat64} {
+		for i := 0; i < 100; i++ {
+			if _, err := json.Marshal(interestingValue(v)); err != nil {
+				t.Fatalf("edge case of %g cannot be encoded: %v", v, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const openAPI3Spec = `
+openapi: 3.0.3
+info:
+  title: User Management API
+  version: "1.0"
+paths:
+  /user:
+    post:
+      requestBody:
+        $ref: '#/components/requestBodies/UserBody'
+      responses:
+        "400":
+          description: Bad Request
+        "200":
+          $ref: '#/components/responses/UserResponse'
+  /user/{id}:
+    parameters:
+      - $ref: '#/components/parameters/UserID'
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/User'
+components:
+  parameters:
+    UserID:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: integer
+  requestBodies:
+    UserBody:
+      content:
+        application/xml:
+          schema:
+            type: string
+        application/json:
+          schema:
+            $ref: '#/components/schemas/User'
+  responses:
+    UserResponse:
+      description: OK
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/User'
+  schemas:
+    User:
+      type: object
+      properties:
+        id:
+          type: integer
+        username:
+          type: [string, "null"]
+`
+
+func findEndpoint(endpoints []EndpointInfo, method, path string) *EndpointInfo {
+	for i := range endpoints {
+		if endpoints[i].Method == method && endpoints[i].Path == path {
+			return &endpoints[i]
+		}
+	}
+	return nil
+}
+
+func TestParseSwagger2(t *testing.T) {
+	data, err := os.ReadFile("swagger.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := ParseAPIDefinition(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 5 {
+		t.Errorf("wrong number of endpoints: got %d want %d", len(endpoints), 5)
+	}
+	post := findEndpoint(endpoints, "post", "/user")
+	if post == nil {
+		t.Fatal("POST /user not found")
+	}
+	if _, ok := post.RequestBody["properties"].(map[string]interface{})["username"]; !ok {
+		t.Errorf("request body was not resolved: %v", post.RequestBody)
+	}
+}
+
+func TestParseOpenAPI3(t *testing.T) {
+	endpoints, err := ParseAPIDefinition([]byte(openAPI3Spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 {
+		t.Errorf("wrong number of endpoints: got %d want %d", len(endpoints), 2)
+	}
+
+	post := findEndpoint(endpoints, "post", "/user")
+	if post == nil {
+		t.Fatal("POST /user not found")
+	}
+	if post.RequestBody["type"] != "object" {
+		t.Errorf("JSON request body not preferred: got %v", post.RequestBody)
+	}
+	if post.ResponseBody["type"] != "object" {
+		t.Errorf("response $ref not resolved: got %v", post.ResponseBody)
+	}
+
+	get := findEndpoint(endpoints, "get", "/user/{id}")
+	if get == nil {
+		t.Fatal("GET /user/{id} not found")
+	}
+	if len(get.Parameters) != 1 || get.Parameters[0].In != "path" || get.Parameters[0].Type != "integer" {
+		t.Errorf("path-level parameter not inherited: got %+v", get.Parameters)
+	}
+	username := get.ResponseBody["properties"].(map[string]interface{})["username"].(map[string]interface{})
+	if got := schemaType(username); got != "string" {
+		t.Errorf("wrong 3.1 type: got %q want %q", got, "string")
+	}
+}
+
+func TestParseUnknownVersion(t *testing.T) {
+	if _, err := ParseAPIDefinition([]byte("openapi: 4.0.0\npaths: {}\n")); err == nil {
+		t.Error("expected an error for an unsupported version")
+	}
+}
+
+func TestLoadJSONSpecFromURL(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("..")))
+	defer server.Close()
+
+	data, err := LoadAPIDefinition(server.URL + "/docs/swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := ParseAPIDefinition(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 5 {
+		t.Errorf("wrong number of endpoints: got %d want %d", len(endpoints), 5)
+	}
+
+	if _, err := LoadAPIDefinition(server.URL + "/docs/missing.json"); err == nil {
+		t.Error("expected an error for a missing spec")
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// requestTimeout is how long a request may take before the oracle reports
+// it as a timeout. Set with -timeout.
+var requestTimeout = 10 * time.Second
+
+// targetPollInterval is how often the fuzzer checks whether a target that
+// went down is back.
+const targetPollInterval = 2 * time.Second
+
+// errTargetDown is returned by a step after which the target no longer
+// accepts connections.
+var errTargetDown = errors.New("target is down")
+
+// Failures of a request that got no response.
+const (
+	failureTimeout = "timeout"
+	failureReset   = "reset"
+	failureRefused = "refused"
+	failureOther   = "error"
+)
+
+// Kinds of findings.
+const (
+	findingServerError = "server-error"
+	findingReset       = "connection-reset"
+	findingTimeout     = "timeout"
+	findingTargetDown  = "target-down"
+)
+
+// exchange is one request exactly as it was sent and what came back: a
+// response, or the error that stood in for one.
+type exchange struct {
+	Time     time.Time         `json:"time"`
+	Duration time.Duration     `json:"duration_ns"`
+	Request  recordedRequest   `json:"request"`
+	Response *recordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	// Failure classifies an error after the request was sent: timeout,
+	// reset, refused or error. It is empty for requests that could not be
+	// built.
+	Failure string `json:"failure,omitempty"`
+}
+
+// recordedRequest and recordedResponse hold a body as text when it is valid
+// UTF-8 and in base64 otherwise, so that malformed payloads are kept byte
+// for byte.
+type recordedRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+type recordedResponse struct {
+	Status     int         `json:"status"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+// recordBody returns body as text or, if it is not valid UTF-8, as base64.
+func recordBody(body []byte) (text, encoded string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return "", base64.StdEncoding.EncodeToString(body)
+}
+
+// statusCode returns the status of the response, 0 if there was none.
+func (e exchange) statusCode() int {
+	if e.Response == nil {
+		return 0
+	}
+	return e.Response.Status
+}
+
+// statusCodes returns the status code of every exchange.
+func statusCodes(exchanges []exchange) []int {
+	codes := make([]int, len(exchanges))
+	for i, e := range exchanges {
+		codes[i] = e.statusCode()
+	}
+	return codes
+}
+
+// classifyError tells timeouts, dropped connections and refused connections
+// apart. A Go server that panics in a handler closes the connection without
+// a response, which the client sees as EOF.
+func classifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return failureTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return failureRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return failureReset
+	}
+	return failureOther
+}
+
+// targetAlive reports whether the target accepts connections.
+func targetAlive() bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), targetPollInterval)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// finding is a bug the oracle found, with everything needed to reproduce
+// it: the sequence up to and including the request that failed, as it was
+// sent and answered, and the inputs in corpus format.
+type finding struct {
+	Kind      string `json:"kind"`
+	Operation string `json:"operation"`
+	// Signature identifies findings that are the same bug: kind,
+	// operation and, for server errors, the status code.
+	Signature string         `json:"signature"`
+	Detail    string         `json:"detail"`
+	Time      time.Time      `json:"time"`
+	Target    string         `json:"target"`
+	Sequence  []exchange     `json:"sequence"`
+	Inputs    []requestInput `json:"inputs"`
+}
+
+// oracle decides which exchanges are bugs: 5xx responses, connections the
+// target dropped, requests it did not answer in time, and a target that
+// went down. Every distinct finding is written to dir as soon as it is
+// found, so findings outlive the fuzzer, and is reported once per campaign;
+// signatures found in an earlier campaign with the same dir are not
+// reported again.
+type oracle struct {
+	dir  string
+	seen map[string]bool
+}
+
+// newOracle creates dir if needed and reads the signatures of the findings
+// saved there. With an empty dir findings are only printed.
+func newOracle(dir string) (*oracle, error) {
+	o := &oracle{dir: dir, seen: make(map[string]bool)}
+	if dir == "" {
+		return o, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var saved finding
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("error decoding finding %s: %w", file, err)
+		}
+		o.seen[saved.Signature] = true
+	}
+	return o, nil
+}
+
+// check looks at the exchanges of a sequence and saves what it finds. It
+// returns the steps that produced new findings, and errTargetDown when the
+// target stopped accepting connections, which ends the checking: the
+// failures after that are the crash's, not the requests'.
+func (o *oracle) check(sent []requestInput, exchanges []exchange) ([]int, error) {
+	var steps []int
+	for i, e := range exchanges {
+		var kind, detail string
+		switch {
+		case e.Response != nil && e.Response.Status >= 500:
+			kind, detail = findingServerError, strconv.Itoa(e.Response.Status)+" "+http.StatusText(e.Response.Status)
+		case e.Failure == failureTimeout, e.Failure == failureReset, e.Failure == failureRefused:
+			detail = e.Error
+			switch {
+			case !targetAlive():
+				kind = findingTargetDown
+			case e.Failure == failureTimeout:
+				kind = findingTimeout
+			case e.Failure == failureReset:
+				kind = findingReset
+			default:
+				// refused, but the target is back up
+				continue
+			}
+		default:
+			continue
+		}
+		if o.report(kind, detail, sent[:i+1], exchanges[:i+1]) {
+			steps = append(steps, i)
+		}
+		if kind == findingTargetDown {
+			return steps, errTargetDown
+		}
+	}
+	return steps, nil
+}
+
+// report prints and saves a finding unless one with the same signature was
+// reported before, and says whether it did.
+func (o *oracle) report(kind, detail string, sent []requestInput, exchanges []exchange) bool {
+	last := sent[len(sent)-1]
+	signature := kind + " " + last.Operation
+	if kind == findingServerError {
+		signature += " " + strconv.Itoa(exchanges[len(exchanges)-1].statusCode())
+	}
+	if o.seen[signature] {
+		return false
+	}
+	o.seen[signature] = true
+
+	f := finding{
+		Kind:      kind,
+		Operation: last.Operation,
+		Signature: signature,
+		Detail:    detail,
+		Time:      time.Now(),
+		Target:    baseURL,
+		Sequence:  exchanges,
+		Inputs:    sent,
+	}
+	fmt.Printf("Finding: %s in %s (%s) after %s\n", kind, last.Operation, detail, describeSequence(sent))
+	if o.dir == "" {
+		return true
+	}
+	path := filepath.Join(o.dir, findingFileName(f))
+	if err := writeJSONFile(f, path); err != nil {
+		fmt.Println("Error saving finding:", err)
+	} else {
+		fmt.Println("Saved reproducer to", path)
+	}
+	return true
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// findingFileName names a finding after its time, kind and operation, e.g.
+// 20240102T150405.123456789-server-error-POST-user.json.
+func findingFileName(f finding) string {
+	operation := unsafeFileChars.ReplaceAllString(f.Operation, "-")
+	return fmt.Sprintf("%s-%s-%s.json", f.Time.UTC().Format("20060102T150405.000000000"), f.Kind, strings.Trim(operation, "-"))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOracleSavesFindings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": 1, "username": "ash"}`))
+		case "GET":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("runtime error: index out of range"))
+		case "PUT":
+			// what a panicking handler looks like to the client
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case "DELETE":
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	defer func(old string) { baseURL = old }(baseURL)
+	baseURL = server.URL
+	defer func(old time.Duration) { requestTimeout = old }(requestTimeout)
+	requestTimeout = 100 * time.Millisecond
+
+	g := sampleGraph(t)
+	ops := make(map[string]int)
+	for i, endpoint := range g.endpoints {
+		ops[operationName(endpoint)] = i
+	}
+	var inputs []requestInput
+	for _, name := range []string{"POST /user", "GET /user/{id}", "PUT /user/{id}", "DELETE /user/{id}"} {
+		input := generateInput(g.endpoints[ops[name]], nil)
+		input.Op = ops[name]
+		inputs = append(inputs, input)
+	}
+	inputs[2].RawBody = []byte("{\"username\": \"\xff\"}")
+
+	dir := t.TempDir()
+	o, err := newOracle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, exchanges := g.runInputs(inputs)
+	steps, err := o.check(sent, exchanges)
+	if err != nil || len(steps) != 3 || steps[0] != 1 || steps[1] != 2 || steps[2] != 3 {
+		t.Fatalf("want findings at steps 1, 2 and 3, got %v (%v)", steps, err)
+	}
+	if steps, _ := o.check(sent, exchanges); len(steps) != 0 {
+		t.Errorf("same findings reported twice: %v", steps)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	kinds := make(map[string]finding)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved finding
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatal(err)
+		}
+		kinds[saved.Kind] = saved
+	}
+	if len(kinds) != 3 {
+		t.Fatalf("want 3 kinds of findings, got %d files", len(files))
+	}
+	serverError := kinds[findingServerError]
+	if len(serverError.Sequence) != 2 || serverError.Sequence[1].Response.Status != 500 || serverError.Sequence[1].Response.Body != "runtime error: index out of range" {
+		t.Errorf("server error saved without its sequence: %+v", serverError)
+	}
+	if serverError.Sequence[0].Request.Method != "POST" || serverError.Sequence[1].Request.URL != server.URL+"/user/1" || serverError.Sequence[1].Request.Headers.Get("Authorization") == "" {
+		t.Errorf("requests not recorded as sent: %+v", serverError.Sequence)
+	}
+	reset := kinds[findingReset].Sequence[2]
+	if body, _ := base64.StdEncoding.DecodeString(reset.Request.BodyBase64); string(body) != string(inputs[2].RawBody) {
+		t.Errorf("invalid UTF-8 body not kept byte for byte: %+v", reset.Request)
+	}
+	if timeout := kinds[findingTimeout]; timeout.Operation != "DELETE /user/{id}" || len(timeout.Inputs) != 4 {
+		t.Errorf("wrong timeout finding: %+v", timeout)
+	}
+
+	// a later campaign does not report them again, but a crash is new
+	o, err = newOracle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps, _ := o.check(sent, exchanges); len(steps) != 0 {
+		t.Errorf("findings of an earlier campaign reported again: %v", steps)
+	}
+	server.Close()
+	sent, exchanges = g.runInputs(inputs)
+	if len(sent) != 1 || exchanges[0].Failure != failureRefused {
+		t.Fatalf("sequence not stopped at refused connection: %+v", exchanges)
+	}
+	if steps, err := o.check(sent, exchanges); !errors.Is(err, errTargetDown) || len(steps) != 1 {
+		t.Errorf("dead target not reported: %v, %v", steps, err)
+	}
+}
+
+func TestFindingFileName(t *testing.T) {
+	f := finding{Kind: findingServerError, Operation: "GET /user/{id}", Time: time.Date(2024, 1, 2, 15, 4, 5, 123, time.UTC)}
+	if name := findingFileName(f); name != "20240102T150405.000000123-server-error-GET-user-id.json" {
+		t.Errorf("wrong file name %s", name)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxPatternRepeat bounds unbounded repetitions (*, +, {n,}) when generating
+// strings from a pattern.
+const maxPatternRepeat = 8
+
+// nearMissChance is how often a schema with a pattern gets a string that
+// fails the pattern instead of one that matches it.
+const nearMissChance = 0.15
+
+// nearMissRunes are tried as the one wrong character of a near miss: a
+// character from each class a pattern usually restricts, plus a few that
+// tend to break parsers.
+var nearMissRunes = []rune("aZ5 -_.@/+%#'\"\\\x00é漢")
+
+// compiledPattern is a pattern parsed once for generation and compiled once
+// for checking. excluded holds printable characters that some character
+// class of the pattern rejects, which make good near-miss candidates.
+type compiledPattern struct {
+	tree     *syntax.Regexp
+	check    *regexp.Regexp
+	excluded []rune
+}
+
+var patternCache = make(map[string]*compiledPattern)
+
+func compilePattern(pattern string) (*compiledPattern, error) {
+	if compiled, ok := patternCache[pattern]; ok {
+		return compiled, nil
+	}
+	tree, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing pattern %q: %w", pattern, err)
+	}
+	check, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling pattern %q: %w", pattern, err)
+	}
+	compiled := &compiledPattern{tree: tree.Simplify(), check: check}
+	compiled.excluded = excludedRunes(compiled.tree)
+	patternCache[pattern] = compiled
+	return compiled, nil
+}
+
+// generateFromPattern returns a random string matching pattern, which uses
+// RE2 syntax as accepted by regexp/syntax.
+func generateFromPattern(pattern string) (string, error) {
+	compiled, err := compilePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	// Assertions such as \b are not modelled by the walk, so a few attempts
+	// may be needed.
+	for attempt := 0; attempt < 20; attempt++ {
+		var sb strings.Builder
+		if err := writeRegexp(&sb, compiled.tree); err != nil {
+			return "", fmt.Errorf("error generating from pattern %q: %w", pattern, err)
+		}
+		if compiled.check.MatchString(sb.String()) {
+			return sb.String(), nil
+		}
+	}
+	return "", fmt.Errorf("could not generate a string matching %q", pattern)
+}
+
+// nearMissFromPattern returns a string that fails pattern because of a
+// single character: one character of a matching string is replaced, removed
+// or inserted.
+func nearMissFromPattern(pattern string) (string, error) {
+	compiled, err := compilePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	for attempt := 0; attempt < 100; attempt++ {
+		valid, err := generateFromPattern(pattern)
+		if err != nil {
+			return "", err
+		}
+		runes := []rune(valid)
+		pos := rand.Intn(len(runes) + 1)
+		wrong := nearMissRunes[rand.Intn(len(nearMissRunes))]
+		if len(compiled.excluded) > 0 && rand.Intn(2) == 0 {
+			wrong = compiled.excluded[rand.Intn(len(compiled.excluded))]
+		}
+
+		var candidate []rune
+		switch op := rand.Intn(3); {
+		case op == 0 && pos < len(runes):
+			candidate = append(append(append([]rune{}, runes[:pos]...), wrong), runes[pos+1:]...)
+		case op == 1 && pos < len(runes):
+			candidate = append(append([]rune{}, runes[:pos]...), runes[pos+1:]...)
+		default:
+			candidate = append(append(append([]rune{}, runes[:pos]...), wrong), runes[pos:]...)
+		}
+		if !compiled.check.MatchString(string(candidate)) {
+			return string(candidate), nil
+		}
+	}
+	return "", fmt.Errorf("could not find a near miss for %q", pattern)
+}
+
+// writeRegexp appends a random string produced by re to sb.
+func writeRegexp(sb *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return fmt.Errorf("pattern can never match")
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return nil
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 && rand.Intn(2) == 0 {
+				r = unicode.SimpleFold(r)
+			}
+			sb.WriteRune(r)
+		}
+		return nil
+	case syntax.OpCharClass:
+		sb.WriteRune(randomRuneFromClass(re.Rune))
+		return nil
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		sb.WriteRune(rune(0x20 + rand.Intn(0x7f-0x20)))
+		return nil
+	case syntax.OpCapture:
+		return writeRegexp(sb, re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		low, high := 0, maxPatternRepeat
+		switch re.Op {
+		case syntax.OpPlus:
+			low = 1
+		case syntax.OpQuest:
+			high = 1
+		case syntax.OpRepeat:
+			low, high = re.Min, re.Max
+			if high < 0 {
+				high = low + maxPatternRepeat
+			}
+		}
+		for n := low + rand.Intn(high-low+1); n > 0; n-- {
+			if err := writeRegexp(sb, re.Sub[0]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := writeRegexp(sb, sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	case syntax.OpAlternate:
+		return writeRegexp(sb, re.Sub[rand.Intn(len(re.Sub))])
+	}
+	return fmt.Errorf("unsupported regexp operator %v", re.Op)
+}
+
+// excludedRunes collects the printable ASCII characters, plus newline, that
+// are rejected by at least one character class in the pattern.
+func excludedRunes(re *syntax.Regexp) []rune {
+	seen := make(map[rune]bool)
+	var walk func(*syntax.Regexp)
+	walk = func(re *syntax.Regexp) {
+		if re.Op == syntax.OpCharClass {
+			for r := rune(0x20); r <= 0x7e; r++ {
+				if !seen[r] && !classContains(re.Rune, r) {
+					seen[r] = true
+				}
+			}
+			if !classContains(re.Rune, '\n') {
+				seen['\n'] = true
+			}
+		}
+		for _, sub := range re.Sub {
+			walk(sub)
+		}
+	}
+	walk(re)
+
+	excluded := make([]rune, 0, len(seen))
+	for r := range seen {
+		excluded = append(excluded, r)
+	}
+	sort.Slice(excluded, func(i, j int) bool { return excluded[i] < excluded[j] })
+	return excluded
+}
+
+func classContains(ranges []rune, r rune) bool {
+	for i := 0; i+1 < len(ranges); i += 2 {
+		if ranges[i] <= r && r <= ranges[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// randomRuneFromClass picks a rune from a character class given as sorted
+// [lo, hi] pairs. Printable ASCII is preferred so that negated classes such
+// as [^,] do not mostly produce obscure code points.
+func randomRuneFromClass(ranges []rune) rune {
+	var printable [][2]rune
+	total := 0
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if lo < 0x20 {
+			lo = 0x20
+		}
+		if hi > 0x7e {
+			hi = 0x7e
+		}
+		if lo <= hi {
+			printable = append(printable, [2]rune{lo, hi})
+			total += int(hi-lo) + 1
+		}
+	}
+	if total > 0 && rand.Intn(10) > 0 {
+		n := rand.Intn(total)
+		for _, r := range printable {
+			if size := int(r[1]-r[0]) + 1; n >= size {
+				n -= size
+				continue
+			}
+			return r[0] + rune(n)
+		}
+	}
+
+	i := 2 * rand.Intn(len(ranges)/2)
+	lo, hi := ranges[i], ranges[i+1]
+	if hi-lo > 0xffff {
+		hi = lo + 0xffff
+	}
+	for {
+		r := lo + rune(rand.Intn(int(hi-lo)+1))
+		if r < 0xd800 || r > 0xdfff {
+			return r
+		}
+		lo = 0xe000
+		if hi < lo {
+			return ranges[i]
+		}
+	}
+}
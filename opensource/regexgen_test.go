@@ -0,0 +1,51 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+var testPatterns = []string{
+	`^[A-Z]{3}-\d{4}$`,
+	`^\+?[1-9]\d{7,14}$`,
+	`^(?i)sku_[a-f0-9]+$`,
+	`^[^,;]{1,10}$`,
+	`^(red|green|blue)(-dark)?$`,
+	`^\w+@\w+\.(com|org)$`,
+}
+
+func TestGenerateFromPattern(t *testing.T) {
+	for _, pattern := range testPatterns {
+		re := regexp.MustCompile(pattern)
+		for i := 0; i < 50; i++ {
+			value, err := generateFromPattern(pattern)
+			if err != nil {
+				t.Fatalf("%s: %v", pattern, err)
+			}
+			if !re.MatchString(value) {
+				t.Fatalf("%s: generated %q does not match", pattern, value)
+			}
+		}
+	}
+}
+
+func TestNearMissFromPattern(t *testing.T) {
+	for _, pattern := range testPatterns {
+		re := regexp.MustCompile(pattern)
+		for i := 0; i < 50; i++ {
+			value, err := nearMissFromPattern(pattern)
+			if err != nil {
+				t.Fatalf("%s: %v", pattern, err)
+			}
+			if re.MatchString(value) {
+				t.Fatalf("%s: near miss %q matches", pattern, value)
+			}
+		}
+	}
+}
+
+func TestGenerateFromInvalidPattern(t *testing.T) {
+	if _, err := generateFromPattern(`[a-`); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
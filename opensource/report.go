@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reportInterval is how many iterations pass between two writes of the
+// campaign report, on top of the write after every find.
+const reportInterval = 50
+
+// campaignReport summarizes a campaign so far: what it covered and which
+// mutation operators got it there.
+type campaignReport struct {
+	Started    time.Time       `json:"started"`
+	Updated    time.Time       `json:"updated"`
+	Iterations int             `json:"iterations"`
+	Corpus     int             `json:"corpus"`
+	Blocks     int             `json:"blocks"`
+	HitBuckets int             `json:"hit_buckets"`
+	Findings   int             `json:"findings"`
+	Coverage   *coverageReport `json:"coverage,omitempty"`
+	Operators  []operatorStats `json:"operators"`
+	// Operations are the arms of the operation bandit: how often each
+	// operation was sent and how often that paid off.
+	Operations []banditArm `json:"operations"`
+}
+
+// report collects the campaign report. coverage may be nil when the target
+// could not be asked.
+func (f *fuzzer) report(started time.Time, coverage *coverageReport) campaignReport {
+	return campaignReport{
+		Started:    started,
+		Updated:    time.Now(),
+		Iterations: f.iterations,
+		Corpus:     len(f.corpus.entries),
+		Blocks:     len(f.seen),
+		HitBuckets: f.hits.size(),
+		Findings:   f.findings,
+		Coverage:   coverage,
+		Operators:  f.scheduler.stats(),
+		Operations: append([]banditArm{}, f.operations.arms...),
+	}
+}
+
+// writeJSONFile saves v as indented JSON at path. It writes a temporary
+// file, syncs it and renames it into place, so that a reader never sees
+// half a file and a file that is there survives a crash.
+func writeJSONFile(v interface{}, path string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// printReport prints the campaign totals, the yield of every operator and
+// the attention every operation got.
+func printReport(report campaignReport) {
+	fmt.Printf("Campaign: %d iterations in %s, %d corpus entries, %d blocks, %d hit buckets, %d findings\n",
+		report.Iterations, report.Updated.Sub(report.Started).Round(time.Second), report.Corpus, report.Blocks, report.HitBuckets, report.Findings)
+	if report.Coverage != nil {
+		printCoverage(*report.Coverage)
+	}
+	fmt.Printf("  %-32s %7s %6s %7s %6s %6s %8s %7s\n", "operator", "uses", "finds", "yield", "blocks", "hits", "findings", "weight")
+	for _, op := range report.Operators {
+		// operators the scheduler does not pick have no weight
+		weight := "-"
+		if op.Weight > 0 {
+			weight = fmt.Sprintf("%.2f%%", 100*op.Weight)
+		}
+		fmt.Printf("  %-32s %7d %6d %6.2f%% %6d %6d %8d %7s\n", op.Name, op.Uses, op.Finds, 100*op.Yield, op.Blocks, op.Hits, op.Findings, weight)
+	}
+	fmt.Printf("  %-32s %7s %7s %7s\n", "operation", "sent", "paid", "rate")
+	for _, arm := range report.Operations {
+		rate := 0.0
+		if arm.Pulls > 0 {
+			rate = float64(arm.Rewards) / float64(arm.Pulls)
+		}
+		fmt.Printf("  %-32s %7d %7d %6.2f%%\n", arm.Name, arm.Pulls, arm.Rewards, 100*rate)
+	}
+}
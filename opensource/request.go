@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// baseURL is where the target API is listening.
+var baseURL = "http://localhost:4000"
+
+// requestIDHeader carries the ID under which the target records the
+// coverage of a single request.
+const requestIDHeader = "X-Fuzz-Request-Id"
+
+// requestInput is one concrete request: the values chosen for an operation's
+// parameters and body. Corpus entries are sequences of these so that they can
+// be replayed and mutated. Params is keyed by parameter name and also holds
+// values for templated path segments the spec does not declare; an optional
+// parameter missing from Params is not sent. Pinned lists parameters a
+// mutation set on purpose, which must not be overwritten by values threaded
+// from earlier responses. RequestID tags the request so that the target
+// can report the blocks it covered, which end up in Reached. RawBody, when
+// set, is sent instead of Body, with ContentType if that is set; Malformed
+// names how it was broken.
+type requestInput struct {
+	Op          int                    `json:"-"`
+	Operation   string                 `json:"operation"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Body        interface{}            `json:"body,omitempty"`
+	RawBody     []byte                 `json:"raw_body,omitempty"`
+	ContentType string                 `json:"content_type,omitempty"`
+	Malformed   string                 `json:"malformed,omitempty"`
+	Pinned      []string               `json:"pinned,omitempty"`
+	RequestID   string                 `json:"-"`
+	Reached     []string               `json:"reached,omitempty"`
+}
+
+// clone returns a copy of the input whose params can be changed freely.
+func (in requestInput) clone() requestInput {
+	params := make(map[string]interface{}, len(in.Params))
+	for name, value := range in.Params {
+		params[name] = value
+	}
+	in.Params = params
+	in.Pinned = append([]string(nil), in.Pinned...)
+	in.RequestID = ""
+	in.Reached = nil
+	return in
+}
+
+func (in requestInput) pinned(name string) bool {
+	return containsString(in.Pinned, name)
+}
+
+// generateInput chooses values for every path, query, header, cookie and
+// formData parameter of endpoint and for its request body. Values in fixed
+// override everything else by parameter name (and top-level body property
+// name); otherwise a value harvested from an earlier response is reused when
+// one exists, and a fresh one is generated when not. Optional parameters are
+// left out half of the time.
+func generateInput(endpoint EndpointInfo, fixed map[string]interface{}) requestInput {
+	input := requestInput{
+		Operation: operationName(endpoint),
+		Params:    make(map[string]interface{}),
+	}
+	for _, param := range endpoint.Parameters {
+		if param.In == "body" {
+			continue
+		}
+		if value, ok := fixed[param.Name]; ok {
+			input.Params[param.Name] = value
+			continue
+		}
+		if !param.Required && rand.Intn(2) == 0 {
+			continue
+		}
+		input.Params[param.Name] = generateParamValue(param, endpoint.Path)
+	}
+
+	// Fill templated segments the spec forgot to declare as parameters.
+	for _, match := range pathTemplate.FindAllStringSubmatch(endpoint.Path, -1) {
+		name := match[1]
+		if _, ok := input.Params[name]; ok {
+			continue
+		}
+		value, ok := fixed[name]
+		if !ok {
+			value, ok = harvested.lookup(name, endpoint.Path)
+		}
+		if !ok {
+			value = generateFieldValue(name, map[string]interface{}{"type": "string"})
+		}
+		input.Params[name] = value
+	}
+
+	input.Body = generateBody(endpoint, fixed)
+	return input
+}
+
+// generateParamValue produces a value for one parameter, preferring values
+// harvested from earlier responses some of the time.
+func generateParamValue(param ParameterInfo, path string) interface{} {
+	if param.Type == "file" {
+		content := make([]byte, rand.Intn(256))
+		rand.Read(content)
+		return string(content)
+	}
+	if value, ok := pickHarvested(param, path); ok {
+		return value
+	}
+	return generateFieldValue(param.Name, param.Schema)
+}
+
+// generateBody produces a request body for endpoint, or nil if it takes none.
+func generateBody(endpoint EndpointInfo, fixed map[string]interface{}) interface{} {
+	if endpoint.RequestBody == nil {
+		return nil
+	}
+	if t := schemaType(endpoint.RequestBody); t != "" && t != "object" {
+		return generateRandomValue(endpoint.RequestBody)
+	}
+	return fixBodyFields(endpoint.RequestBody, generateRandomData(endpoint.RequestBody), fixed)
+}
+
+// buildRequest turns an input into an HTTP request, serializing each
+// parameter into its location and encoding the body according to the
+// endpoint's content type.
+func buildRequest(endpoint EndpointInfo, input requestInput) (*http.Request, error) {
+	path := endpoint.Path
+	query := url.Values{}
+	headers := http.Header{}
+	var cookies []string
+	form := url.Values{}
+	files := make(map[string]string)
+
+	for _, param := range endpoint.Parameters {
+		value, ok := input.Params[param.Name]
+		if !ok || param.In == "body" {
+			continue
+		}
+		if param.Type == "file" {
+			files[param.Name] = formatParamValue(value)
+			continue
+		}
+
+		switch param.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+param.Name+"}", url.PathEscape(strings.Join(serializeParamValue(param, value), ",")))
+		case "query":
+			for _, v := range serializeParamValue(param, value) {
+				query.Add(param.Name, v)
+			}
+		case "header":
+			headers.Set(param.Name, strings.Join(serializeParamValue(param, value), ","))
+		case "cookie":
+			cookies = append(cookies, param.Name+"="+strings.Join(serializeParamValue(param, value), ","))
+		case "formData":
+			for _, v := range serializeParamValue(param, value) {
+				form.Add(param.Name, v)
+			}
+		}
+	}
+	path = pathTemplate.ReplaceAllStringFunc(path, func(segment string) string {
+		return url.PathEscape(formatParamValue(input.Params[segment[1:len(segment)-1]]))
+	})
+
+	body, contentType, err := buildRequestBody(endpoint, input.Body, form, files)
+	if err != nil {
+		return nil, err
+	}
+	if input.RawBody != nil {
+		body = bytes.NewReader(input.RawBody)
+		if contentType == "" || isFormContentType(contentType) {
+			contentType = "application/json"
+		}
+		if input.ContentType != "" {
+			contentType = input.ContentType
+		}
+	}
+
+	requestURL := baseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(strings.ToUpper(endpoint.Method), requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	if len(cookies) > 0 {
+		req.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if input.RequestID != "" {
+		req.Header.Set(requestIDHeader, input.RequestID)
+	}
+	return req, nil
+}
+
+// buildRequestBody encodes the form fields, file parts or the request body
+// according to the endpoint's content type. It returns a nil reader for
+// operations that take no body.
+func buildRequestBody(endpoint EndpointInfo, data interface{}, form url.Values, files map[string]string) (io.Reader, string, error) {
+	contentType := endpoint.ContentType
+	if object, ok := data.(map[string]interface{}); ok && isFormContentType(contentType) {
+		// OpenAPI 3.x describes form fields as the properties of the body
+		for key, value := range object {
+			form.Set(key, formatParamValue(value))
+		}
+		data = nil
+	}
+
+	switch {
+	case contentType == "multipart/form-data" && (len(form) > 0 || len(files) > 0):
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		for name, values := range form {
+			for _, value := range values {
+				if err := writer.WriteField(name, value); err != nil {
+					return nil, "", err
+				}
+			}
+		}
+		for name, content := range files {
+			part, err := writer.CreateFormFile(name, name+".bin")
+			if err != nil {
+				return nil, "", err
+			}
+			io.WriteString(part, content)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+		return &buf, writer.FormDataContentType(), nil
+	case len(form) > 0:
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil
+	case data != nil || endpoint.RequestBody != nil:
+		requestBody, err := json.Marshal(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("error marshalling request body: %w", err)
+		}
+		if contentType == "" || isFormContentType(contentType) {
+			contentType = "application/json"
+		}
+		return bytes.NewReader(requestBody), contentType, nil
+	default:
+		return nil, "", nil
+	}
+}
+
+// fixBodyFields overrides the generated properties of a body object that are
+// pinned in fixed.
+func fixBodyFields(schema map[string]interface{}, data map[string]interface{}, fixed map[string]interface{}) map[string]interface{} {
+	props, _ := schema["properties"].(map[string]interface{})
+	for name, value := range fixed {
+		if _, ok := props[name]; ok {
+			data[name] = value
+		}
+	}
+	return data
+}
+
+// pickHarvested returns a value harvested from an earlier response for a
+// parameter, some of the time.
+func pickHarvested(param ParameterInfo, path string) (interface{}, bool) {
+	chance := harvestedChance
+	if param.In == "path" {
+		chance = harvestedPathChance
+	}
+	if rand.Float64() >= chance {
+		return nil, false
+	}
+	return harvested.lookup(param.Name, path)
+}
+
+func isFormContentType(contentType string) bool {
+	return contentType == "application/x-www-form-urlencoded" || contentType == "multipart/form-data"
+}
+
+// serializeParamValue renders a parameter value as one or more strings. A
+// single string is returned unless the value is an array that is exploded
+// into repeated query or form fields (collectionFormat multi in Swagger 2.0,
+// explode: true in OpenAPI 3.x).
+func serializeParamValue(param ParameterInfo, value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return []string{formatParamValue(value)}
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = formatParamValue(item)
+	}
+	if param.CollectionFormat == "multi" || (param.Explode && (param.In == "query" || param.In == "formData")) {
+		return values
+	}
+
+	separator := ","
+	switch {
+	case param.CollectionFormat == "ssv" || param.Style == "spaceDelimited":
+		separator = " "
+	case param.CollectionFormat == "tsv":
+		separator = "\t"
+	case param.CollectionFormat == "pipes" || param.Style == "pipeDelimited":
+		separator = "|"
+	}
+	return []string{strings.Join(values, separator)}
+}
+
+// formatParamValue renders a single generated value the way it would appear
+// in a URL, header or form field.
+func formatParamValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}, orderedObject:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
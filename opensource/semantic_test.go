@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFieldTokens(t *testing.T) {
+	tests := map[string][]string{
+		"firstName":     {"first", "name"},
+		"first_name":    {"first", "name"},
+		"HTTPCallback":  {"http", "callback"},
+		"User ID":       {"user", "id"},
+		"contact-email": {"contact", "email"},
+	}
+	for input, want := range tests {
+		if got := fieldTokens(input); !reflect.DeepEqual(got, want) {
+			t.Errorf("fieldTokens(%q): got %v want %v", input, got, want)
+		}
+	}
+}
+
+func TestFindSemanticRule(t *testing.T) {
+	str := map[string]interface{}{"type": "string"}
+	tests := map[string]string{
+		"username":      "username",
+		"user_name":     "username",
+		"firstName":     "first name",
+		"contact_email": "email",
+		"country":       "country",
+		"avatarUrl":     "url",
+		"domain_name":   "domain",
+		"host_name":     "hostname",
+		"country_name":  "country",
+		"city_name":     "city",
+		"name":          "name",
+		"fullName":      "full name",
+	}
+	for name, word := range tests {
+		rule := findSemanticRule(name, str)
+		if rule == nil || rule.words[0] != semanticRuleFor(word).words[0] {
+			t.Errorf("%s: wrong rule %v", name, rule)
+		}
+	}
+	if rule := findSemanticRule("id", str); rule != nil {
+		t.Errorf("id should not match a rule, got %v", rule.words)
+	}
+	if rule := findSemanticRule("count", map[string]interface{}{"type": "integer", "description": "Display name"}); rule != nil {
+		t.Errorf("a string rule matched an integer field: %v", rule.words)
+	}
+}
+
+func TestGenerateSemanticHonorsBounds(t *testing.T) {
+	for _, schema := range []map[string]interface{}{
+		{"type": "string", "maxLength": 2},
+		{"type": "string", "minLength": 5, "maxLength": 8},
+		{"type": "number", "minimum": 1, "maximum": 10},
+	} {
+		name := "username"
+		if schema["type"] == "number" {
+			name = "price"
+		}
+		for i := 0; i < 200; i++ {
+			if value, ok := generateSemantic(name, schema); ok {
+				if problems := validateSchema(schema, jsonRoundTrip(value), ""); len(problems) != 0 {
+					t.Fatalf("%s value %v ignores %v: %v", name, value, schema, problems)
+				}
+			}
+		}
+	}
+}
+
+func semanticRuleFor(word string) *semanticRule {
+	for i := range semanticRules {
+		for _, w := range semanticRules[i].words {
+			if w == word {
+				return &semanticRules[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// specFetchTimeout bounds how long we wait for a target to serve its spec.
+const specFetchTimeout = 10 * time.Second
+
+// LoadAPIDefinition reads an API description from a local file or, when the
+// source starts with http:// or https://, from a live URL such as the
+// target's own /docs/swagger.json.
+func LoadAPIDefinition(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("error reading API definition %s: %w", source, err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating spec request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, application/yaml, text/yaml, */*")
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	req.Header.Set("User-Agent", "Go-Client")
+
+	client := &http.Client{Timeout: specFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching API definition %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading API definition %s: %w", source, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching API definition %s: status %d", source, resp.StatusCode)
+	}
+	return data, nil
+}
+
+// decodeSpec unmarshals an API description into generic maps. The format is
+// detected from the content rather than the file name or Content-Type, since
+// targets frequently serve YAML as text/plain and JSON with a .txt suffix.
+// A leading UTF-8 byte order mark, as Windows tools write it, is dropped.
+func decodeSpec(data []byte) (map[string]interface{}, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if isJSON(data) {
+		var spec map[string]interface{}
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return nil, fmt.Errorf("error unmarshalling JSON data: %w", err)
+		}
+		return spec, nil
+	}
+
+	var spec map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("error unmarshalling YAML data: %w", err)
+	}
+	return convertMapInterfaceToString(spec), nil
+}
+
+// isJSON reports whether data looks like a JSON object.
+func isJSON(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
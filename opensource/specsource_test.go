@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDecodeSpecWithByteOrderMark(t *testing.T) {
+	for name, data := range map[string]string{
+		"json": "\xef\xbb\xbf{\"swagger\": \"2.0\", \"paths\": {}}",
+		"yaml": "\xef\xbb\xbfswagger: \"2.0\"\npaths: {}\n",
+	} {
+		spec, err := decodeSpec([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if spec["swagger"] != "2.0" {
+			t.Errorf("%s: wrong spec %v", name, spec)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/muskinfra/covdata"
+)
+
+// routeReport is the statement coverage of the handler behind one route and
+// method, with the blocks of the handler that were never reached.
+type routeReport struct {
+	Method   string           `json:"method"`
+	Path     string           `json:"path"`
+	Handler  string           `json:"handler"`
+	Source   string           `json:"source"`
+	Count    int              `json:"count"`
+	Stmt     int              `json:"stmt"`
+	Coverage string           `json:"coverage"`
+	Missed   []uncoveredBlock `json:"missed,omitempty"`
+}
+
+// handlerFunc returns the function that serves h: the function itself for
+// an http.HandlerFunc, the ServeHTTP method for other handler types.
+func handlerFunc(h http.Handler) *runtime.Func {
+	v := reflect.ValueOf(h)
+	if v.Kind() == reflect.Func {
+		return runtime.FuncForPC(v.Pointer())
+	}
+	if m, ok := reflect.TypeOf(h).MethodByName("ServeHTTP"); ok {
+		return runtime.FuncForPC(m.Func.Pointer())
+	}
+	return nil
+}
+
+// coverFuncName converts a runtime function name such as
+// "main.(*User).IsEmpty" into the name coverage meta-data uses,
+// "*User.IsEmpty". Function literals are instrumented as part of the
+// function they are declared in, so "main.SetupSwagger.func1" becomes
+// "SetupSwagger".
+func coverFuncName(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	_, name, _ = strings.Cut(name, ".")
+	name = strings.TrimSuffix(name, "-fm")
+	name = strings.NewReplacer("(", "", ")", "").Replace(name)
+	if i := strings.Index(name, ".func"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// handlerBlocks returns the blocks of profile that belong to fn.
+func handlerBlocks(profile *covdata.Profile, fn *runtime.Func) []covdata.Block {
+	file, _ := fn.FileLine(fn.Entry())
+	file = filepath.ToSlash(file)
+	name := coverFuncName(fn.Name())
+	var blocks []covdata.Block
+	for _, block := range profile.Blocks() {
+		if block.Func != name {
+			continue
+		}
+		rel := strings.TrimPrefix(block.File, block.ModulePath+"/")
+		if file == block.File || strings.HasSuffix(file, "/"+rel) {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// routeReports walks router and reports the coverage of each route's
+// handler, once per method. Routes whose handler has no instrumented
+// statements in profile, such as handlers from other modules or functions
+// the filter left out, are skipped.
+func routeReports(router *mux.Router, profile *covdata.Profile, root string) ([]routeReport, error) {
+	var reports []routeReport
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		handler := route.GetHandler()
+		if handler == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		fn := handlerFunc(handler)
+		if fn == nil {
+			return nil
+		}
+		blocks := handlerBlocks(profile, fn)
+		if len(blocks) == 0 {
+			return nil
+		}
+
+		report := routeReport{Path: path, Handler: coverFuncName(fn.Name())}
+		first, last := blocks[0].StartLine, blocks[0].EndLine
+		for _, block := range blocks {
+			first = min(first, block.StartLine)
+			last = max(last, block.EndLine)
+			report.Stmt += int(block.Stmts)
+			if block.Count > 0 {
+				report.Count += int(block.Stmts)
+				continue
+			}
+			lines, _ := block.Lines(root)
+			report.Missed = append(report.Missed, uncoveredBlock{
+				Position: block.Position(),
+				Func:     block.Func,
+				Stmts:    int(block.Stmts),
+				Lines:    lines,
+			})
+		}
+		report.Source = fmt.Sprintf("%s:%d-%d", blocks[0].File, first, last)
+		report.Coverage = fmt.Sprintf("%.2f%%", 100*float64(report.Count)/float64(report.Stmt))
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"ANY"}
+		}
+		for _, method := range methods {
+			report.Method = method
+			reports = append(reports, report)
+		}
+		return nil
+	})
+	return reports, err
+}
+
+// routeCoverageSoFar reports coverage per route and method of router, e.g.
+// GET /user/{id} served by getUser. It takes the same filter parameters as
+// /coverage.
+func routeCoverageSoFar(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println("Called RouteCoverageSoFar")
+		w.Header().Set("Content-Type", "application/json")
+		filter, err := coverageFilter(r)
+		if err != nil {
+			writeJSONError(w, 400, err)
+			return
+		}
+		profile, err := readProfile(filter)
+		if err != nil {
+			writeJSONError(w, 400, err)
+			return
+		}
+		reports, err := routeReports(router, profile, sourceDir())
+		if err != nil {
+			writeJSONError(w, 400, err)
+			return
+		}
+		if reports == nil {
+			reports = []routeReport{}
+		}
+		result := make(map[string]interface{})
+		result["routes"] = reports
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/coverage"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/muskinfra/covdata"
+	"golang.org/x/tools/cover"
+)
+
+// Snapshots are kept in COVERAGE_SNAPSHOT_DIR, one directory per name laid
+// out like GOCOVERDIR, so that go tool covdata and covreport can read them
+// too. Only the COVERAGE_SNAPSHOT_KEEP most recent are kept.
+const (
+	defaultSnapshotDir  = "coverage-snapshots"
+	defaultSnapshotKeep = 20
+)
+
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// snapshotMu keeps snapshots from being written and pruned concurrently.
+var snapshotMu sync.Mutex
+
+// snapshotInfo describes a stored snapshot.
+type snapshotInfo struct {
+	Name     string    `json:"name"`
+	Taken    time.Time `json:"taken"`
+	Count    int       `json:"count"`
+	Stmt     int       `json:"stmt"`
+	Coverage string    `json:"coverage"`
+}
+
+// uncoveredBlock is a block no request has reached yet, with its source.
+type uncoveredBlock struct {
+	Position string   `json:"position"`
+	Func     string   `json:"func"`
+	Stmts    int      `json:"stmts"`
+	Lines    []string `json:"lines,omitempty"`
+}
+
+func snapshotDir() string {
+	if dir := os.Getenv("COVERAGE_SNAPSHOT_DIR"); dir != "" {
+		return dir
+	}
+	return defaultSnapshotDir
+}
+
+func snapshotKeep() int {
+	if keep, err := strconv.Atoi(os.Getenv("COVERAGE_SNAPSHOT_KEEP")); err == nil && keep > 0 {
+		return keep
+	}
+	return defaultSnapshotKeep
+}
+
+// sourceDir is where the target's source is checked out, for listing the
+// lines of uncovered blocks.
+func sourceDir() string {
+	if dir := os.Getenv("COVERAGE_SOURCE_DIR"); dir != "" {
+		return dir
+	}
+	return "."
+}
+
+// writeSnapshot stores the current meta and counter data under name,
+// replacing an older snapshot of the same name, and prunes the oldest
+// snapshots beyond the retention limit.
+func writeSnapshot(name string) error {
+	var metaBuf, counterBuf bytes.Buffer
+	if err := coverage.WriteMeta(&metaBuf); err != nil {
+		return err
+	}
+	if err := coverage.WriteCounters(&counterBuf); err != nil {
+		return err
+	}
+	meta, err := readMeta()
+	if err != nil {
+		return err
+	}
+
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	// write into a scratch directory first, so that a failed snapshot
+	// never replaces a good one
+	tmp, err := os.MkdirTemp(snapshotDir(), "."+name+"-")
+	if os.IsNotExist(err) {
+		if err = os.MkdirAll(snapshotDir(), 0o755); err == nil {
+			tmp, err = os.MkdirTemp(snapshotDir(), "."+name+"-")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	metaFile := fmt.Sprintf("covmeta.%x", meta.Hash)
+	counterFile := fmt.Sprintf("covcounters.%x.%d.%d", meta.Hash, os.Getpid(), time.Now().UnixNano())
+	if err := os.WriteFile(filepath.Join(tmp, metaFile), metaBuf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, counterFile), counterBuf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	target := filepath.Join(snapshotDir(), name)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+	return pruneSnapshots(snapshotKeep())
+}
+
+// listSnapshots returns the stored snapshots, oldest first.
+func listSnapshots() ([]snapshotInfo, error) {
+	entries, err := os.ReadDir(snapshotDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []snapshotInfo
+	for _, entry := range entries {
+		if !entry.IsDir() || !snapshotName.MatchString(entry.Name()) || entry.Name()[0] == '.' {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshotInfo{Name: entry.Name(), Taken: info.ModTime()})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Taken.Before(snapshots[j].Taken) })
+	return snapshots, nil
+}
+
+func pruneSnapshots(keep int) error {
+	snapshots, err := listSnapshots()
+	if err != nil {
+		return err
+	}
+	for len(snapshots) > keep {
+		if err := os.RemoveAll(filepath.Join(snapshotDir(), snapshots[0].Name)); err != nil {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
+
+// loadSnapshot reads a stored snapshot, or the live counters for "" or
+// "current", and keeps the functions filter selects.
+func loadSnapshot(name string, filter covdata.Filter) (*covdata.Profile, error) {
+	if name == "" || name == "current" {
+		return readProfile(filter)
+	}
+	if !snapshotName.MatchString(name) || name[0] == '.' {
+		return nil, fmt.Errorf("invalid snapshot name %q", name)
+	}
+	profile, err := covdata.ReadDirs(filepath.Join(snapshotDir(), name))
+	if err != nil {
+		return nil, err
+	}
+	return profile.Filter(filter), nil
+}
+
+// toCoverageBlock converts a merged block into the form /coverage/blocks
+// returns, with the same ID.
+func toCoverageBlock(block covdata.Block) coverageBlock {
+	pb := cover.ProfileBlock{
+		StartLine: int(block.StartLine),
+		StartCol:  int(block.StartCol),
+		EndLine:   int(block.EndLine),
+		EndCol:    int(block.EndCol),
+		NumStmt:   int(block.Stmts),
+		Count:     int(block.Count),
+	}
+	return coverageBlock{
+		ID:    blockID(block.File, pb),
+		File:  block.File,
+		Start: fmt.Sprintf("%d.%d", pb.StartLine, pb.StartCol),
+		End:   fmt.Sprintf("%d.%d", pb.EndLine, pb.EndCol),
+		Stmts: pb.NumStmt,
+		Count: pb.Count,
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err.Error())
+}
+
+// takeSnapshot stores the current coverage as /coverage/snapshots/{name}.
+func takeSnapshot(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("Called TakeSnapshot")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["name"]
+	if !snapshotName.MatchString(name) || name[0] == '.' || name == "current" {
+		writeJSONError(w, 400, fmt.Errorf("invalid snapshot name %q", name))
+		return
+	}
+	if err := writeSnapshot(name); err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	json.NewEncoder(w).Encode(fmt.Sprintf("Snapshot %s taken", name))
+}
+
+// snapshotsSoFar lists the stored snapshots with their statement coverage.
+func snapshotsSoFar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	filter, err := coverageFilter(r)
+	if err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	snapshotMu.Lock()
+	snapshots, err := listSnapshots()
+	snapshotMu.Unlock()
+	if err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	for i := range snapshots {
+		profile, err := loadSnapshot(snapshots[i].Name, filter)
+		if err != nil {
+			writeJSONError(w, 400, err)
+			return
+		}
+		total := profile.Total()
+		snapshots[i].Count = total.Covered
+		snapshots[i].Stmt = total.Total
+		snapshots[i].Coverage = fmt.Sprintf("%.2f%%", total.Percent())
+	}
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// diffSnapshots lists the blocks covered in snapshot "to" (default: the live
+// counters) that were not covered in snapshot "from".
+func diffSnapshots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	filter, err := coverageFilter(r)
+	if err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	from, err := loadSnapshot(r.URL.Query().Get("from"), filter)
+	if err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	to, err := loadSnapshot(r.URL.Query().Get("to"), filter)
+	if err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	blocks := []coverageBlock{}
+	for _, block := range covdata.NewlyCovered(from, to) {
+		blocks = append(blocks, toCoverageBlock(block))
+	}
+	result := make(map[string]interface{})
+	result["blocks"] = blocks
+	json.NewEncoder(w).Encode(result)
+}
+
+// uncoveredSoFar lists the blocks of a snapshot (default: the live counters)
+// that were never reached, with their source lines.
+func uncoveredSoFar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	filter, err := coverageFilter(r)
+	if err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	profile, err := loadSnapshot(r.URL.Query().Get("snapshot"), filter)
+	if err != nil {
+		writeJSONError(w, 400, err)
+		return
+	}
+	blocks := []uncoveredBlock{}
+	for _, block := range profile.Uncovered() {
+		lines, _ := block.Lines(sourceDir())
+		blocks = append(blocks, uncoveredBlock{
+			Position: block.Position(),
+			Func:     block.Func,
+			Stmts:    int(block.Stmts),
+			Lines:    lines,
+		})
+	}
+	result := make(map[string]interface{})
+	result["blocks"] = blocks
+	json.NewEncoder(w).Encode(result)
+}